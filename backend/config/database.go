@@ -1,9 +1,12 @@
 package config
 
 import (
+	"fmt"
 	"log"
+	"net/url"
 	"os"
 	"strconv"
+	"time"
 
 	"skin-performance/models"
 
@@ -22,7 +25,7 @@ func InitDB() (*gorm.DB, error) {
 
 	dsn := AppConfig.DBUser + ":" + AppConfig.DBPassword + "@tcp(" + 
 		AppConfig.DBHost + ":" + AppConfig.DBPort + ")/" + 
-		AppConfig.DBName + "?charset=utf8mb4&parseTime=True&loc=Local"
+		AppConfig.DBName + "?charset=utf8mb4&parseTime=True&loc=" + url.QueryEscape(AppConfig.Location.String())
 
 	log.Printf("连接数据库: %s", AppConfig.DBHost)
 
@@ -42,7 +45,25 @@ func AutoMigrate(db *gorm.DB) error {
 	db.Exec("SET FOREIGN_KEY_CHECKS = 0")
 	defer db.Exec("SET FOREIGN_KEY_CHECKS = 1")
 
-	return db.AutoMigrate(
+	// 新增状态字段前的历史单据视为已确认，保证原有报表数据不变
+	backfillVisitStatus := db.Migrator().HasTable(&models.Visit{}) && !db.Migrator().HasColumn(&models.Visit{}, "status")
+	// 新增标价字段前的历史明细以成交金额为标价，不计入低价成交
+	backfillListPrice := db.Migrator().HasTable(&models.VisitItem{}) && !db.Migrator().HasColumn(&models.VisitItem{}, "list_price")
+	// 电话改为加密存储后，唯一约束改在盲索引 phone_hash 上
+	if db.Migrator().HasIndex(&models.Customer{}, "uniq_phone") {
+		if err := db.Migrator().DropIndex(&models.Customer{}, "uniq_phone"); err != nil {
+			return err
+		}
+	}
+
+	// 结算记录改为按版本保留历史，唯一约束加入版本号
+	if db.Migrator().HasIndex(&models.PerformanceSettlement{}, "uniq_employee_month") {
+		if err := db.Migrator().DropIndex(&models.PerformanceSettlement{}, "uniq_employee_month"); err != nil {
+			return err
+		}
+	}
+
+	if err := db.AutoMigrate(
 		&models.Customer{},
 		&models.Project{},
 		&models.Employee{},
@@ -51,7 +72,138 @@ func AutoMigrate(db *gorm.DB) error {
 		&models.VisitItem{},
 		&models.RevisitRecord{},
 		&models.ProductConsumption{},
-	)
+		&models.CommissionPlan{},
+		&models.CommissionRule{},
+		&models.CommissionTier{},
+		&models.PerformanceSettlement{},
+		&models.VisitItemAllocation{},
+		&models.Refund{},
+		&models.RefundAllocation{},
+		&models.Payment{},
+		&models.StoredValueAccount{},
+		&models.StoredValueTransaction{},
+		&models.Package{},
+		&models.CustomerPackage{},
+		&models.Coupon{},
+		&models.CustomerMergeLog{},
+		&models.RFMSegment{},
+		&models.Channel{},
+		&models.Tag{},
+		&models.CustomerSegment{},
+		&models.ContactAccessLog{},
+	); err != nil {
+		return err
+	}
+
+	if backfillVisitStatus {
+		if err := db.Model(&models.Visit{}).Where("status = ?", models.VisitStatusDraft).
+			Update("status", models.VisitStatusConfirmed).Error; err != nil {
+			return err
+		}
+	}
+
+	if backfillListPrice {
+		if err := db.Unscoped().Model(&models.VisitItem{}).Where("1 = 1").
+			Update("list_price", gorm.Expr("amount")).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := encryptLegacyPhones(db); err != nil {
+		return err
+	}
+
+	if err := seedRFMSegments(db); err != nil {
+		return err
+	}
+	if err := seedChannels(db); err != nil {
+		return err
+	}
+
+	return migrateVisitItemAllocations(db)
+}
+
+// encryptLegacyPhones 加密改造前以明文保存的电话，并为顾客补写盲索引；只处理未加密的记录，可重复执行
+func encryptLegacyPhones(db *gorm.DB) error {
+	var customers []models.Customer
+	if err := db.Unscoped().Select("id", "phone").Where("phone_hash IS NULL").Find(&customers).Error; err != nil {
+		return err
+	}
+	for i := range customers {
+		customer := &customers[i]
+		customer.SetPhone(string(customer.Phone))
+		if err := db.Unscoped().Model(&models.Customer{}).Where("id = ?", customer.ID).UpdateColumns(map[string]interface{}{
+			"phone":             customer.Phone,
+			"phone_hash":        customer.PhoneHash,
+			"phone_suffix_hash": customer.PhoneSuffixHash,
+		}).Error; err != nil {
+			return fmt.Errorf("加密顾客 %d 的电话失败（可能与其他顾客号码重复）: %w", customer.ID, err)
+		}
+	}
+
+	var employees []models.Employee
+	if err := db.Unscoped().Select("id", "phone").
+		Where("phone IS NOT NULL AND phone <> '' AND phone NOT LIKE ?", models.PhoneCipherPrefix+"%").Find(&employees).Error; err != nil {
+		return err
+	}
+	for _, employee := range employees {
+		if err := db.Unscoped().Model(&models.Employee{}).Where("id = ?", employee.ID).
+			UpdateColumn("phone", employee.Phone).Error; err != nil {
+			return err
+		}
+	}
+	if len(customers) > 0 || len(employees) > 0 {
+		log.Printf("已加密 %d 位顾客、%d 位员工的电话", len(customers), len(employees))
+	}
+	return nil
+}
+
+// seedRFMSegments 分群定义为空时写入默认分群，之后可在分群管理中调整
+func seedRFMSegments(db *gorm.DB) error {
+	var count int64
+	if err := db.Unscoped().Model(&models.RFMSegment{}).Count(&count).Error; err != nil || count > 0 {
+		return err
+	}
+
+	intPtr := func(v int) *int { return &v }
+	moneyPtr := func(v models.Money) *models.Money { return &v }
+	strPtr := func(v string) *string { return &v }
+	now := time.Now()
+	segments := []models.RFMSegment{
+		{Code: "high_value_lapsing", Name: "高价值流失风险", MonetaryMin: moneyPtr(1000000), RecencyDaysMin: intPtr(90), Priority: 100,
+			Description: strPtr("累计消费1万元以上，90天未就诊")},
+		{Code: "high_value_active", Name: "高价值活跃", MonetaryMin: moneyPtr(1000000), RecencyDaysMax: intPtr(89), Priority: 90,
+			Description: strPtr("累计消费1万元以上，90天内有就诊")},
+		{Code: "dormant", Name: "沉睡顾客", RecencyDaysMin: intPtr(180), Priority: 50,
+			Description: strPtr("180天未就诊")},
+		{Code: "single_visit", Name: "待复购新客", FrequencyMax: intPtr(1), RecencyDaysMax: intPtr(89), Priority: 40,
+			Description: strPtr("只就诊过一次，90天内")},
+		{Code: "regular", Name: "一般顾客", Priority: 0,
+			Description: strPtr("其他顾客")},
+	}
+	for i := range segments {
+		segments[i].IsActive = true
+		segments[i].CreatedAt = &now
+		segments[i].UpdatedAt = &now
+	}
+	return db.Create(&segments).Error
+}
+
+// migrateVisitItemAllocations 将旧的固定人员字段迁移为业绩分配记录
+// 只处理尚无分配记录的明细，可重复执行
+func migrateVisitItemAllocations(db *gorm.DB) error {
+	var items []models.VisitItem
+	return db.Where("NOT EXISTS (SELECT 1 FROM visit_item_allocations a WHERE a.visit_item_id = visit_items.id)").
+		FindInBatches(&items, 500, func(tx *gorm.DB, batch int) error {
+			var allocations []models.VisitItemAllocation
+			for _, item := range items {
+				allocations = append(allocations, item.LegacyAllocations()...)
+			}
+			if len(allocations) == 0 {
+				return nil
+			}
+			return tx.Create(&allocations).Error
+		}).Error
 }
 
 func GetDB() *gorm.DB {
@@ -79,6 +231,25 @@ func LoadConfig() {
 		ServerPort:       getEnv("SERVER_PORT", "8080"),
 		GinMode:          getEnv("GIN_MODE", gin.DebugMode),
 		CORSAllowOrigins: getEnv("CORS_ALLOW_ORIGINS", "*"),
+		PhoneEncryptionKey: getEnv("PHONE_ENCRYPTION_KEY", ""),
+		PhoneIndexKey:      getEnv("PHONE_INDEX_KEY", ""),
+		ContactViewRoles:   getEnv("CONTACT_VIEW_ROLES", models.RoleAdmin+","+models.RoleConsultant),
+		Timezone:           getEnv("CLINIC_TIMEZONE", ""),
+	}
+
+	// 诊所时区：数据库连接按该时区读写时间，报表按该时区划分日/周/月，未配置时使用服务器时区
+	AppConfig.Location = time.Local
+	if AppConfig.Timezone != "" {
+		loc, err := time.LoadLocation(AppConfig.Timezone)
+		if err != nil {
+			log.Fatalf("无效的时区 %s: %v", AppConfig.Timezone, err)
+		}
+		AppConfig.Location = loc
+	}
+
+	// 电话加密和盲索引密钥必须配置，没有默认值；上线后不能直接修改，轮换方法见 README
+	if err := models.InitPhoneCrypto(AppConfig.PhoneEncryptionKey, AppConfig.PhoneIndexKey); err != nil {
+		log.Fatalf("电话加密初始化失败: %v", err)
 	}
 
 	log.Println("配置加载完成")
@@ -111,6 +282,41 @@ type Config struct {
 	ServerPort        string
 	GinMode           string
 	CORSAllowOrigins  string
+	PhoneEncryptionKey string
+	PhoneIndexKey      string
+	ContactViewRoles   string // 可查看完整联系方式的角色，逗号分隔
+	Timezone           string // 诊所时区，如 Asia/Shanghai
+	Location           *time.Location // 由 Timezone 解析的诊所时区
 }
 
 var AppConfig *Config
+
+// ClinicLocation 诊所时区，配置未加载时为服务器时区
+func ClinicLocation() *time.Location {
+	if AppConfig == nil || AppConfig.Location == nil {
+		return time.Local
+	}
+	return AppConfig.Location
+}
+
+// seedChannels 渠道字典为空时写入常用来源渠道
+func seedChannels(db *gorm.DB) error {
+	var count int64
+	if err := db.Unscoped().Model(&models.Channel{}).Count(&count).Error; err != nil || count > 0 {
+		return err
+	}
+
+	now := time.Now()
+	channels := []models.Channel{
+		{Code: "dianping", Name: "大众点评", SortOrder: 10},
+		{Code: "xiaohongshu", Name: "小红书", SortOrder: 20},
+		{Code: "walk_in", Name: "自然到店", SortOrder: 30},
+		{Code: "referral", Name: "老客转介绍", SortOrder: 40},
+	}
+	for i := range channels {
+		channels[i].IsActive = true
+		channels[i].CreatedAt = &now
+		channels[i].UpdatedAt = &now
+	}
+	return db.Create(&channels).Error
+}
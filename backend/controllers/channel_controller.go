@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"skin-performance/config"
+	"skin-performance/models"
+)
+
+// ListChannels 获取来源渠道列表，active_only=true 时只返回启用的渠道
+func ListChannels(c *gin.Context) {
+	var channels []models.Channel
+	query := config.GetDB().Model(&models.Channel{})
+	if c.Query("active_only") == "true" {
+		query = query.Where("is_active = ?", true)
+	}
+
+	if err := query.Order("sort_order, id").Find(&channels).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    channels,
+	})
+}
+
+// CreateChannel 创建来源渠道
+func CreateChannel(c *gin.Context) {
+	var channel models.Channel
+	if err := c.ShouldBindJSON(&channel); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误"})
+		return
+	}
+	if msg := validateChannel(config.GetDB(), &channel); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": msg})
+		return
+	}
+
+	now := time.Now()
+	channel.CreatedAt = &now
+	channel.UpdatedAt = &now
+	channel.IsActive = true
+
+	if err := config.GetDB().Create(&channel).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "创建成功",
+		"data":    channel,
+	})
+}
+
+// ChannelUpdateRequest 更新渠道请求，未提交 is_active 时保持原启用状态
+type ChannelUpdateRequest struct {
+	models.Channel
+	IsActive *bool `json:"is_active"`
+}
+
+// UpdateChannel 更新来源渠道，停用后新顾客不能再选择该渠道
+func UpdateChannel(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	var channel models.Channel
+	if err := config.GetDB().First(&channel, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "渠道不存在"})
+		return
+	}
+
+	var req ChannelUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误"})
+		return
+	}
+	merged := channel
+	if req.Code != "" {
+		merged.Code = req.Code
+	}
+	if req.Name != "" {
+		merged.Name = req.Name
+	}
+	if msg := validateChannel(config.GetDB(), &merged); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": msg})
+		return
+	}
+
+	updates := map[string]interface{}{
+		"code":       merged.Code,
+		"name":       merged.Name,
+		"sort_order": req.SortOrder,
+		"remark":     req.Remark,
+		"updated_at": time.Now(),
+	}
+	if req.IsActive != nil {
+		updates["is_active"] = *req.IsActive
+	}
+	if err := config.GetDB().Model(&channel).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "更新成功",
+		"data":    channel,
+	})
+}
+
+// DeleteChannel 删除来源渠道（软删除），已关联的顾客保留原渠道
+func DeleteChannel(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	if err := config.GetDB().Delete(&models.Channel{}, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "删除失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "删除成功",
+	})
+}
+
+// validateChannel 校验来源渠道，返回错误信息
+func validateChannel(db *gorm.DB, channel *models.Channel) string {
+	if channel.Code == "" || channel.Name == "" {
+		return "渠道代码和名称为必填项"
+	}
+	var count int64
+	db.Model(&models.Channel{}).Where("code = ? AND id <> ?", channel.Code, channel.ID).Count(&count)
+	if count > 0 {
+		return "渠道代码已存在"
+	}
+	return ""
+}
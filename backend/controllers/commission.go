@@ -0,0 +1,247 @@
+package controllers
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"skin-performance/models"
+)
+
+// commissionRates 某条明细适用的提成比例
+type commissionRates struct {
+	MainDoctor float64
+	CoDoctor   float64
+	Nurse      float64
+	Consultant float64
+}
+
+// matchCommissionRule 从候选规则中选出指定角色、项目、日期下适用的规则
+// 具体项目 > 项目分类 > 通用规则，同一层级内优先级高者优先，优先级相同取后创建的
+func matchCommissionRule(rules []models.CommissionRule, role string, project models.Project, at time.Time) *models.CommissionRule {
+	var best *models.CommissionRule
+	bestLevel := -1
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Role != role || !rule.EffectiveOn(at) {
+			continue
+		}
+
+		level := 0
+		if rule.ProjectID != nil {
+			if *rule.ProjectID != project.ID {
+				continue
+			}
+			level = 2
+		} else if rule.ProjectCategory != nil {
+			if project.Category == nil || *rule.ProjectCategory != *project.Category {
+				continue
+			}
+			level = 1
+		}
+
+		if best == nil || level > bestLevel ||
+			(level == bestLevel && (rule.Priority > best.Priority ||
+				(rule.Priority == best.Priority && rule.ID > best.ID))) {
+			best = rule
+			bestLevel = level
+		}
+	}
+	return best
+}
+
+// findCommissionPlan 查询指定日期有效的提成方案，有效期重叠时取生效日期最晚、版本最高者
+// 没有有效方案时返回 nil
+func findCommissionPlan(db *gorm.DB, at time.Time) (*models.CommissionPlan, error) {
+	var plans []models.CommissionPlan
+	day := at.Format("2006-01-02")
+	if err := db.Where("is_active = ? AND valid_from <= ? AND (valid_to IS NULL OR valid_to >= ?)", true, day, day).
+		Order("valid_from DESC, version DESC").Limit(1).Find(&plans).Error; err != nil {
+		return nil, err
+	}
+	if len(plans) == 0 {
+		return nil, nil
+	}
+	return &plans[0], nil
+}
+
+// resolveCommissionRates 查询方案下项目在指定日期适用的提成比例，未配置规则的角色使用默认比例
+// plan 为 nil 时使用未归属方案的规则
+func resolveCommissionRates(db *gorm.DB, plan *models.CommissionPlan, project models.Project, at time.Time) (commissionRates, error) {
+	var rules []models.CommissionRule
+	query := db.Where("is_active = ?", true)
+	if plan != nil {
+		query = query.Where("plan_id = ?", plan.ID)
+	} else {
+		query = query.Where("plan_id IS NULL")
+	}
+	if err := query.Find(&rules).Error; err != nil {
+		return commissionRates{}, err
+	}
+
+	rates := commissionRates{
+		MainDoctor: models.DefaultMainDoctorRatio,
+		CoDoctor:   models.DefaultCoDoctorRatio,
+		Nurse:      models.DefaultNurseRatio,
+		Consultant: models.DefaultConsultantRatio,
+	}
+	if rule := matchCommissionRule(rules, models.CommissionRoleMainDoctor, project, at); rule != nil {
+		rates.MainDoctor = rule.Ratio
+	}
+	if rule := matchCommissionRule(rules, models.CommissionRoleCoDoctor, project, at); rule != nil {
+		rates.CoDoctor = rule.Ratio
+	}
+	if rule := matchCommissionRule(rules, models.CommissionRoleNurse, project, at); rule != nil {
+		rates.Nurse = rule.Ratio
+	}
+	if rule := matchCommissionRule(rules, models.CommissionRoleConsultant, project, at); rule != nil {
+		rates.Consultant = rule.Ratio
+	}
+	return rates, nil
+}
+
+// applyCommissionRates 按提成比例计算明细各参与人员的业绩，并回写明细的固定字段
+// base 为业绩基数（通常为明细金额，疗程明细见 performanceBase）。
+// 协同医生未填写比例时使用规则默认比例；护士、咨询师分别按各自比例计算，不影响医生业绩；
+// 主操医生获得基数减去各协同医生业绩后的剩余部分（再乘主操比例），
+// 协同业绩四舍五入产生的尾差因此全部由主操医生承担，医生业绩之和始终等于基数。
+func applyCommissionRates(item *models.VisitItem, rates commissionRates, base models.Money) {
+	coTotalRatio := 0.0
+	var coTotal models.Money
+	for i := range item.Allocations {
+		a := &item.Allocations[i]
+		if a.RoleInItem != models.CommissionRoleCoDoctor {
+			continue
+		}
+		if a.Ratio == 0 {
+			a.Ratio = rates.CoDoctor
+		}
+		coTotalRatio += a.Ratio
+		a.Performance = base.MulRatio(a.Ratio)
+		coTotal += a.Performance
+	}
+	// 明细已由 validateVisitItem 校验协同比例合计不超过1，这里仅防御规则默认比例叠加超限
+	if coTotalRatio > 1 {
+		coTotalRatio = 1
+	}
+	if coTotal > base {
+		coTotal = base
+	}
+
+	for i := range item.Allocations {
+		a := &item.Allocations[i]
+		switch a.RoleInItem {
+		case models.CommissionRoleMainDoctor:
+			a.Ratio = (1 - coTotalRatio) * rates.MainDoctor
+			a.Performance = (base - coTotal).MulRatio(rates.MainDoctor)
+		case models.CommissionRoleNurse:
+			a.Ratio = rates.Nurse
+			a.Performance = base.MulRatio(a.Ratio)
+		case models.CommissionRoleConsultant:
+			a.Ratio = rates.Consultant
+			a.Performance = base.MulRatio(a.Ratio)
+		}
+	}
+
+	item.SyncLegacyFields()
+}
+
+// saveAllocations 用明细当前的分配记录替换已保存的分配记录
+func saveAllocations(tx *gorm.DB, item *models.VisitItem) error {
+	if err := tx.Where("visit_item_id = ?", item.ID).Delete(&models.VisitItemAllocation{}).Error; err != nil {
+		return err
+	}
+	if len(item.Allocations) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	for i := range item.Allocations {
+		item.Allocations[i].ID = 0
+		item.Allocations[i].VisitItemID = item.ID
+		item.Allocations[i].CreatedAt = &now
+		item.Allocations[i].UpdatedAt = &now
+		item.Allocations[i].Employee = nil
+	}
+	return tx.Create(&item.Allocations).Error
+}
+
+// calculatePerformance 根据提成规则计算业绩分配
+// 按明细所属就诊的就诊日期匹配当时有效的提成方案，并记录所用方案
+func calculatePerformance(db *gorm.DB, item *models.VisitItem) error {
+	var visit models.Visit
+	if err := db.First(&visit, item.VisitID).Error; err != nil {
+		return err
+	}
+	plan, err := findCommissionPlan(db, visit.VisitDate)
+	if err != nil {
+		return err
+	}
+	return calculatePerformanceWithPlan(db, item, plan, visit)
+}
+
+// calculatePerformanceWithPlan 使用指定提成方案计算业绩分配
+// 咨询师不由明细填写，始终按就诊单据当前的咨询师生成
+func calculatePerformanceWithPlan(db *gorm.DB, item *models.VisitItem, plan *models.CommissionPlan, visit models.Visit) error {
+	var project models.Project
+	if err := db.First(&project, item.ProjectID).Error; err != nil {
+		return err
+	}
+
+	rates, err := resolveCommissionRates(db, plan, project, visit.VisitDate)
+	if err != nil {
+		return err
+	}
+	base, err := performanceBase(db, item)
+	if err != nil {
+		return err
+	}
+	if len(item.Allocations) == 0 {
+		item.Allocations = item.LegacyAllocations()
+	}
+	setConsultantAllocation(item, visit.ConsultantID)
+	applyCommissionRates(item, rates, base)
+
+	item.CommissionPlanID = nil
+	if plan != nil {
+		item.CommissionPlanID = &plan.ID
+	}
+	return nil
+}
+
+// setConsultantAllocation 用就诊单据的咨询师替换明细中的咨询师分配，consultantID 为 nil 时移除
+func setConsultantAllocation(item *models.VisitItem, consultantID *uint) {
+	allocations := item.Allocations[:0]
+	for _, a := range item.Allocations {
+		if a.RoleInItem != models.CommissionRoleConsultant {
+			allocations = append(allocations, a)
+		}
+	}
+	if consultantID != nil {
+		allocations = append(allocations, models.VisitItemAllocation{
+			EmployeeID: *consultantID,
+			RoleInItem: models.CommissionRoleConsultant,
+		})
+	}
+	item.Allocations = allocations
+}
+
+// recalculateVisitPerformance 重新计算就诊单据下所有明细的业绩分配（如更换咨询师后）
+func recalculateVisitPerformance(tx *gorm.DB, visitID uint) error {
+	var items []models.VisitItem
+	if err := tx.Preload("Allocations").Where("visit_id = ?", visitID).Find(&items).Error; err != nil {
+		return err
+	}
+	for i := range items {
+		item := &items[i]
+		if err := calculatePerformance(tx, item); err != nil {
+			return err
+		}
+		if err := tx.Model(item).Select(performanceColumns).Updates(item).Error; err != nil {
+			return err
+		}
+		if err := saveAllocations(tx, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,443 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"skin-performance/config"
+	"skin-performance/models"
+)
+
+// ListCommissionPlans 获取提成方案列表
+func ListCommissionPlans(c *gin.Context) {
+	var plans []models.CommissionPlan
+	query := config.GetDB().Model(&models.CommissionPlan{})
+
+	if name := c.Query("name"); name != "" {
+		query = query.Where("name = ?", name)
+	}
+	if c.Query("active_only") == "true" {
+		query = query.Where("is_active = ?", true)
+	}
+
+	// 分页
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	var total int64
+	query.Count(&total)
+
+	if err := query.Order("valid_from DESC, version DESC").Limit(pageSize).Offset((page - 1) * pageSize).Find(&plans).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"list":      plans,
+			"total":     total,
+			"page":      page,
+			"page_size": pageSize,
+		},
+	})
+}
+
+// GetCommissionPlan 获取单个提成方案（含规则）
+func GetCommissionPlan(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	var plan models.CommissionPlan
+	if err := config.GetDB().Preload("Rules").First(&plan, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "提成方案不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    plan,
+	})
+}
+
+// CreateCommissionPlan 创建提成方案版本
+// 同名方案的版本号自动递增；请求中携带的规则会一并创建
+func CreateCommissionPlan(c *gin.Context) {
+	var plan models.CommissionPlan
+	if err := c.ShouldBindJSON(&plan); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误"})
+		return
+	}
+
+	if plan.Name == "" || plan.ValidFrom.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "方案名称和生效日期为必填项"})
+		return
+	}
+	if plan.ValidTo != nil && plan.ValidTo.Before(plan.ValidFrom) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "失效日期不能早于生效日期"})
+		return
+	}
+	for i := range plan.Rules {
+		if msg := validateCommissionRule(&plan.Rules[i]); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": msg})
+			return
+		}
+	}
+
+	now := time.Now()
+	plan.CreatedAt = &now
+	plan.UpdatedAt = &now
+	plan.IsActive = true
+	for i := range plan.Rules {
+		plan.Rules[i].CreatedAt = &now
+		plan.Rules[i].UpdatedAt = &now
+		plan.Rules[i].IsActive = true
+	}
+
+	tx := config.GetDB().Begin()
+	var maxVersion int
+	tx.Model(&models.CommissionPlan{}).Unscoped().Where("name = ?", plan.Name).Select("COALESCE(MAX(version), 0)").Scan(&maxVersion)
+	plan.Version = maxVersion + 1
+
+	if err := tx.Create(&plan).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建失败: " + err.Error()})
+		return
+	}
+	tx.Commit()
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "创建成功",
+		"data":    plan,
+	})
+}
+
+// CommissionPlanUpdateRequest 更新提成方案请求，未提交的字段保持不变
+type CommissionPlanUpdateRequest struct {
+	ValidFrom *time.Time `json:"valid_from"`
+	ValidTo   *time.Time `json:"valid_to"`
+	IsActive  *bool      `json:"is_active"`
+	Remark    *string    `json:"remark"`
+}
+
+// UpdateCommissionPlan 更新提成方案（名称和版本号不可修改），已被明细引用的方案可改为停用
+func UpdateCommissionPlan(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	var plan models.CommissionPlan
+	if err := config.GetDB().First(&plan, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "提成方案不存在"})
+		return
+	}
+
+	var req CommissionPlanUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误"})
+		return
+	}
+
+	updates := map[string]interface{}{"updated_at": time.Now()}
+	validFrom := plan.ValidFrom
+	if req.ValidFrom != nil && !req.ValidFrom.IsZero() {
+		validFrom = *req.ValidFrom
+		updates["valid_from"] = validFrom
+	}
+	validTo := plan.ValidTo
+	if req.ValidTo != nil {
+		validTo = req.ValidTo
+		updates["valid_to"] = *req.ValidTo
+	}
+	if validTo != nil && validTo.Before(validFrom) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "失效日期不能早于生效日期"})
+		return
+	}
+	if req.IsActive != nil {
+		updates["is_active"] = *req.IsActive
+	}
+	if req.Remark != nil {
+		updates["remark"] = *req.Remark
+	}
+
+	if err := config.GetDB().Model(&plan).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新失败"})
+		return
+	}
+	config.GetDB().First(&plan, plan.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "更新成功",
+		"data":    plan,
+	})
+}
+
+// DeleteCommissionPlan 删除提成方案（软删除）
+// 已被明细引用的方案不可删除
+func DeleteCommissionPlan(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	var used int64
+	config.GetDB().Model(&models.VisitItem{}).Where("commission_plan_id = ?", id).Count(&used)
+	if used > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "方案已被业绩明细引用，请改为停用"})
+		return
+	}
+
+	tx := config.GetDB().Begin()
+	if err := tx.Where("plan_id = ?", id).Delete(&models.CommissionRule{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "删除规则失败"})
+		return
+	}
+	if err := tx.Delete(&models.CommissionPlan{}, id).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "删除失败"})
+		return
+	}
+	tx.Commit()
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "删除成功",
+	})
+}
+
+// RecalculateRequest 历史业绩重算请求
+// 涉及的月份已有结算记录时，需带 invalidate_settlements 才能写入，已有结算记录在同一事务中作废
+type RecalculateRequest struct {
+	DateFrom              string `json:"date_from" binding:"required"`
+	DateTo                string `json:"date_to" binding:"required"`
+	Commit                bool   `json:"commit"`
+	InvalidateSettlements bool   `json:"invalidate_settlements"`
+}
+
+// allocationSnapshot 单个参与人员的业绩快照
+type allocationSnapshot struct {
+	EmployeeID  uint         `json:"employee_id"`
+	RoleInItem  string       `json:"role_in_item"`
+	Ratio       float64      `json:"ratio"`
+	Performance models.Money `json:"performance"`
+}
+
+// performanceSnapshot 明细业绩分配快照
+type performanceSnapshot struct {
+	CommissionPlanID *uint                `json:"commission_plan_id"`
+	Allocations      []allocationSnapshot `json:"allocations"`
+}
+
+// PerformanceDiff 重算前后业绩差异
+type PerformanceDiff struct {
+	VisitItemID uint                `json:"visit_item_id"`
+	VisitNo     string              `json:"visit_no"`
+	VisitDate   time.Time           `json:"visit_date"`
+	Old         performanceSnapshot `json:"old"`
+	New         performanceSnapshot `json:"new"`
+	RefundCount int                 `json:"refund_count"`
+}
+
+func snapshotPerformance(item models.VisitItem) performanceSnapshot {
+	snapshot := performanceSnapshot{
+		CommissionPlanID: item.CommissionPlanID,
+		Allocations:      make([]allocationSnapshot, 0, len(item.Allocations)),
+	}
+	for _, a := range item.Allocations {
+		snapshot.Allocations = append(snapshot.Allocations, allocationSnapshot{
+			EmployeeID:  a.EmployeeID,
+			RoleInItem:  a.RoleInItem,
+			Ratio:       a.Ratio,
+			Performance: a.Performance,
+		})
+	}
+	return snapshot
+}
+
+// samePerformance 判断两次快照的方案和分配结果是否一致
+func samePerformance(a, b performanceSnapshot) bool {
+	if (a.CommissionPlanID == nil) != (b.CommissionPlanID == nil) ||
+		(a.CommissionPlanID != nil && *a.CommissionPlanID != *b.CommissionPlanID) {
+		return false
+	}
+	if len(a.Allocations) != len(b.Allocations) {
+		return false
+	}
+	for i := range a.Allocations {
+		if a.Allocations[i] != b.Allocations[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// RecalculateCommissionPlan 按指定方案重算日期范围内的明细业绩
+// 只重算未作废的单据，且只重算就诊日期在方案有效期内的明细；明细已有退款时按新业绩重新生成退款冲减。
+// 默认只返回差异；commit 为 true 时在同一事务中写入重算结果。
+// 重算会改变已确认单据的业绩，受影响月份（就诊日期及退款日期所在月）已结算的，需同时作废结算记录
+func RecalculateCommissionPlan(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	var req RecalculateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误"})
+		return
+	}
+
+	var plan models.CommissionPlan
+	if err := config.GetDB().First(&plan, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "提成方案不存在"})
+		return
+	}
+
+	tx := config.GetDB().Begin()
+	var items []models.VisitItem
+	if err := tx.Preload("Visit").Preload("Allocations").
+		Joins("JOIN visits ON visits.id = visit_items.visit_id AND visits.deleted_at IS NULL").
+		Where("visits.status <> ?", models.VisitStatusVoided).
+		Where("visits.visit_date >= ? AND visits.visit_date <= ?", req.DateFrom, req.DateTo+" 23:59:59").
+		Order("visits.visit_date, visit_items.id").
+		Find(&items).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+
+	diffs := []PerformanceDiff{}
+	skipped := 0
+	affectedMonths := make(map[string]bool)
+	for i := range items {
+		item := items[i]
+		if !plan.ValidOn(item.Visit.VisitDate) {
+			skipped++
+			continue
+		}
+		old := snapshotPerformance(item)
+		if err := calculatePerformanceWithPlan(tx, &item, &plan, item.Visit); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "业绩计算失败: " + err.Error()})
+			return
+		}
+		updated := snapshotPerformance(item)
+		if samePerformance(old, updated) {
+			continue
+		}
+
+		var refunds []models.Refund
+		if err := tx.Where("visit_item_id = ?", item.ID).Find(&refunds).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询退款失败"})
+			return
+		}
+		affectedMonths[item.Visit.VisitDate.Format("2006-01")] = true
+		for _, refund := range refunds {
+			affectedMonths[refund.RefundDate.Format("2006-01")] = true
+		}
+		diffs = append(diffs, PerformanceDiff{
+			VisitItemID: item.ID,
+			VisitNo:     item.Visit.VisitID,
+			VisitDate:   item.Visit.VisitDate,
+			Old:         old,
+			New:         updated,
+			RefundCount: len(refunds),
+		})
+
+		if req.Commit {
+			if err := tx.Model(&item).Select(performanceColumns).Updates(&item).Error; err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "写入重算结果失败"})
+				return
+			}
+			if err := saveAllocations(tx, &item); err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "写入重算结果失败"})
+				return
+			}
+			if err := rebuildRefundAllocations(tx, &item, refunds); err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "重新生成退款冲减失败"})
+				return
+			}
+		}
+	}
+
+	// 受影响月份中已结算的月份
+	settledMonths := []string{}
+	if len(affectedMonths) > 0 {
+		months := make([]string, 0, len(affectedMonths))
+		for month := range affectedMonths {
+			months = append(months, month)
+		}
+		if err := tx.Model(&models.PerformanceSettlement{}).Where("month IN ?", months).
+			Distinct("month").Order("month").Pluck("month", &settledMonths).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询结算记录失败"})
+			return
+		}
+	}
+
+	if req.Commit {
+		if len(settledMonths) > 0 {
+			if !req.InvalidateSettlements {
+				tx.Rollback()
+				c.JSON(http.StatusBadRequest, gin.H{
+					"code":    400,
+					"message": "以下月份已结算，需作废结算记录后才能写入重算结果：" + strings.Join(settledMonths, "、"),
+					"data":    gin.H{"settled_months": settledMonths},
+				})
+				return
+			}
+			if err := tx.Where("month IN ?", settledMonths).Delete(&models.PerformanceSettlement{}).Error; err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "作废结算记录失败"})
+				return
+			}
+		}
+		if err := tx.Commit().Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "写入重算结果失败"})
+			return
+		}
+	} else {
+		tx.Rollback()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"plan":           plan,
+			"date_from":      req.DateFrom,
+			"date_to":        req.DateTo,
+			"scanned":        len(items),
+			"skipped":        skipped,
+			"changed":        len(diffs),
+			"settled_months": settledMonths,
+			"committed":      req.Commit,
+			"diffs":          diffs,
+		},
+	})
+}
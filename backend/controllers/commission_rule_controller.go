@@ -0,0 +1,245 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"skin-performance/config"
+	"skin-performance/models"
+)
+
+// ListCommissionRules 获取提成规则列表
+func ListCommissionRules(c *gin.Context) {
+	var rules []models.CommissionRule
+	query := config.GetDB().Model(&models.CommissionRule{}).Preload("Project")
+
+	// 筛选条件
+	if role := c.Query("role"); role != "" {
+		query = query.Where("role = ?", role)
+	}
+	if projectID := c.Query("project_id"); projectID != "" {
+		query = query.Where("project_id = ?", projectID)
+	}
+	if category := c.Query("project_category"); category != "" {
+		query = query.Where("project_category = ?", category)
+	}
+	if c.Query("active_only") == "true" {
+		query = query.Where("is_active = ?", true)
+	}
+
+	// 分页
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	var total int64
+	query.Count(&total)
+
+	if err := query.Order("role, priority DESC, id DESC").Limit(pageSize).Offset((page - 1) * pageSize).Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"list":      rules,
+			"total":     total,
+			"page":      page,
+			"page_size": pageSize,
+		},
+	})
+}
+
+// GetCommissionRule 获取单个提成规则
+func GetCommissionRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	var rule models.CommissionRule
+	if err := config.GetDB().Preload("Project").First(&rule, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "提成规则不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    rule,
+	})
+}
+
+// CreateCommissionRule 创建提成规则
+func CreateCommissionRule(c *gin.Context) {
+	var rule models.CommissionRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误"})
+		return
+	}
+
+	if msg := validateCommissionRule(&rule); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": msg})
+		return
+	}
+
+	// 设置创建时间
+	now := time.Now()
+	rule.CreatedAt = &now
+	rule.UpdatedAt = &now
+	rule.IsActive = true
+
+	if err := config.GetDB().Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "创建成功",
+		"data":    rule,
+	})
+}
+
+// CommissionRuleUpdateRequest 更新提成规则请求，未提交的字段保持不变；
+// 适用范围（项目、项目分类）整体替换，未提交视为通用规则
+type CommissionRuleUpdateRequest struct {
+	Name            *string    `json:"name"`
+	Role            *string    `json:"role"`
+	ProjectCategory *string    `json:"project_category"`
+	ProjectID       *uint      `json:"project_id"`
+	Ratio           *float64   `json:"ratio"`
+	Priority        *int       `json:"priority"`
+	EffectiveFrom   *time.Time `json:"effective_from"`
+	EffectiveTo     *time.Time `json:"effective_to"`
+	IsActive        *bool      `json:"is_active"`
+	Remark          *string    `json:"remark"`
+}
+
+// UpdateCommissionRule 更新提成规则
+func UpdateCommissionRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	var rule models.CommissionRule
+	if err := config.GetDB().First(&rule, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "提成规则不存在"})
+		return
+	}
+
+	var req CommissionRuleUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误"})
+		return
+	}
+
+	// 合并到规则副本上校验，比例、优先级为 0 和停用都是合法的更新
+	merged := rule
+	if req.Name != nil {
+		merged.Name = *req.Name
+	}
+	if req.Role != nil {
+		merged.Role = *req.Role
+	}
+	if req.Ratio != nil {
+		merged.Ratio = *req.Ratio
+	}
+	if req.Priority != nil {
+		merged.Priority = *req.Priority
+	}
+	if req.EffectiveFrom != nil {
+		merged.EffectiveFrom = req.EffectiveFrom
+	}
+	if req.EffectiveTo != nil {
+		merged.EffectiveTo = req.EffectiveTo
+	}
+	if req.IsActive != nil {
+		merged.IsActive = *req.IsActive
+	}
+	if req.Remark != nil {
+		merged.Remark = req.Remark
+	}
+	merged.ProjectID = req.ProjectID
+	merged.ProjectCategory = req.ProjectCategory
+	if merged.ProjectCategory != nil && *merged.ProjectCategory == "" {
+		merged.ProjectCategory = nil
+	}
+	if msg := validateCommissionRule(&merged); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": msg})
+		return
+	}
+
+	updates := map[string]interface{}{
+		"name":             merged.Name,
+		"role":             merged.Role,
+		"project_category": merged.ProjectCategory,
+		"project_id":       merged.ProjectID,
+		"ratio":            merged.Ratio,
+		"priority":         merged.Priority,
+		"effective_from":   merged.EffectiveFrom,
+		"effective_to":     merged.EffectiveTo,
+		"is_active":        merged.IsActive,
+		"remark":           merged.Remark,
+		"updated_at":       time.Now(),
+	}
+	if err := config.GetDB().Model(&rule).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新失败"})
+		return
+	}
+	config.GetDB().Preload("Project").First(&rule, rule.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "更新成功",
+		"data":    rule,
+	})
+}
+
+// DeleteCommissionRule 删除提成规则（软删除）
+func DeleteCommissionRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	if err := config.GetDB().Delete(&models.CommissionRule{}, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "删除失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "删除成功",
+	})
+}
+
+// validateCommissionRule 校验提成规则，返回错误信息
+func validateCommissionRule(rule *models.CommissionRule) string {
+	if rule.Name == "" || rule.Role == "" {
+		return "规则名称和角色为必填项"
+	}
+	if !models.IsCommissionRole(rule.Role) {
+		return "无效的提成角色"
+	}
+	if rule.Ratio < 0 || rule.Ratio > 1 {
+		return "提成比例必须在0到1之间"
+	}
+	if rule.EffectiveFrom != nil && rule.EffectiveTo != nil && rule.EffectiveTo.Before(*rule.EffectiveFrom) {
+		return "失效日期不能早于生效日期"
+	}
+	return ""
+}
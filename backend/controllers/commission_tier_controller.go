@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"skin-performance/config"
+	"skin-performance/models"
+)
+
+// ListCommissionTiers 获取阶梯提成档位列表
+func ListCommissionTiers(c *gin.Context) {
+	var tiers []models.CommissionTier
+	query := config.GetDB().Model(&models.CommissionTier{})
+
+	if planID := c.Query("plan_id"); planID != "" {
+		query = query.Where("plan_id = ?", planID)
+	}
+	if role := c.Query("role"); role != "" {
+		query = query.Where("role = ?", role)
+	}
+	if c.Query("active_only") == "true" {
+		query = query.Where("is_active = ?", true)
+	}
+
+	if err := query.Order("plan_id, role, lower_bound").Find(&tiers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    tiers,
+	})
+}
+
+// CreateCommissionTier 创建阶梯提成档位
+func CreateCommissionTier(c *gin.Context) {
+	var tier models.CommissionTier
+	if err := c.ShouldBindJSON(&tier); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误"})
+		return
+	}
+
+	if msg := validateCommissionTier(&tier); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": msg})
+		return
+	}
+
+	now := time.Now()
+	tier.CreatedAt = &now
+	tier.UpdatedAt = &now
+	tier.IsActive = true
+
+	if err := config.GetDB().Create(&tier).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "创建成功",
+		"data":    tier,
+	})
+}
+
+// UpdateCommissionTier 更新阶梯提成档位
+func UpdateCommissionTier(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	var tier models.CommissionTier
+	if err := config.GetDB().First(&tier, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "提成档位不存在"})
+		return
+	}
+
+	var input models.CommissionTier
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误"})
+		return
+	}
+
+	merged := tier
+	if input.Role != "" {
+		merged.Role = input.Role
+	}
+	if input.LowerBound != 0 {
+		merged.LowerBound = input.LowerBound
+	}
+	if input.UpperBound != nil {
+		merged.UpperBound = input.UpperBound
+	}
+	if input.Rate != 0 {
+		merged.Rate = input.Rate
+	}
+	if msg := validateCommissionTier(&merged); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": msg})
+		return
+	}
+
+	now := time.Now()
+	input.UpdatedAt = &now
+
+	if err := config.GetDB().Model(&tier).Updates(input).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "更新成功",
+		"data":    tier,
+	})
+}
+
+// DeleteCommissionTier 删除阶梯提成档位（软删除）
+func DeleteCommissionTier(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	if err := config.GetDB().Delete(&models.CommissionTier{}, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "删除失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "删除成功",
+	})
+}
+
+// validateCommissionTier 校验阶梯提成档位，返回错误信息
+func validateCommissionTier(tier *models.CommissionTier) string {
+	switch tier.Role {
+	case "":
+		return "员工角色为必填项"
+	case models.RoleDoctor, models.RoleNurse, models.RoleConsultant:
+	default:
+		return "无效的员工角色"
+	}
+	if tier.LowerBound < 0 {
+		return "档位下限不能为负数"
+	}
+	if tier.UpperBound != nil && *tier.UpperBound <= tier.LowerBound {
+		return "档位上限必须大于下限"
+	}
+	if tier.Rate < 0 || tier.Rate > 1 {
+		return "提成比例必须在0到1之间"
+	}
+	return ""
+}
@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"skin-performance/config"
+	"skin-performance/models"
+	"skin-performance/reports"
+)
+
+// ConsultantStats 咨询师在期间内的接诊统计，只统计已确认单据，按就诊日期归属期间
+// 成交单据为至少有一条收费明细（金额大于0）且已收款的单据；ConversionRate = ConvertedCount / VisitCount
+// Revenue 为成交单据的单据金额，AvgTicket = Revenue / ConvertedCount；
+// FirstVisitRevenue 为初诊顾客的成交金额，ReturningRevenue 为复诊和再消费顾客的成交金额
+type ConsultantStats struct {
+	VisitCount        int          `json:"visit_count"`
+	ConvertedCount    int          `json:"converted_count"`
+	ConversionRate    float64      `json:"conversion_rate"`
+	Revenue           models.Money `json:"revenue"`
+	AvgTicket         models.Money `json:"avg_ticket"`
+	FirstVisitRevenue models.Money `json:"first_visit_revenue"`
+	ReturningRevenue  models.Money `json:"returning_revenue"`
+	// Performance 咨询师业绩（扣除退款冲减，退款计入退款日期所在期间）
+	Performance models.Money `json:"performance"`
+}
+
+// finish 计算派生指标
+func (s *ConsultantStats) finish() {
+	if s.VisitCount > 0 {
+		s.ConversionRate = float64(int(float64(s.ConvertedCount)/float64(s.VisitCount)*10000+0.5)) / 10000
+	}
+	if s.ConvertedCount > 0 {
+		s.AvgTicket = s.Revenue.MulRatio(1 / float64(s.ConvertedCount))
+	}
+}
+
+// ConsultantReportRow 咨询师报表行
+type ConsultantReportRow struct {
+	ConsultantID   uint   `json:"consultant_id"`
+	ConsultantName string `json:"consultant_name"`
+	ConsultantStats
+}
+
+// GetConsultantReport 咨询师报表：接诊数、成交率、客单价、初诊与老客成交金额及咨询师业绩
+// 未指定咨询师的单据不计入任何咨询师，单独汇总在 unassigned 中
+func GetConsultantReport(c *gin.Context) {
+	dateFrom := c.Query("date_from")
+	dateTo := c.Query("date_to")
+	if dateFrom == "" {
+		dateFrom = time.Now().In(config.ClinicLocation()).AddDate(0, -1, 0).Format("2006-01-02")
+	}
+	if dateTo == "" {
+		dateTo = time.Now().In(config.ClinicLocation()).Format("2006-01-02")
+	}
+	consultantID := c.Query("consultant_id")
+
+	db := config.GetDB()
+
+	// 先逐单判断是否成交，再按咨询师和就诊时的顾客分类汇总
+	var visitRows []struct {
+		ConsultantID   *uint
+		CustomerType   string
+		VisitCount     int
+		ConvertedCount int
+		Revenue        models.Money
+	}
+	visitsSQL := `
+		SELECT v.consultant_id, COALESCE(v.customer_type, '') as customer_type, v.total_amount,
+			CASE WHEN v.paid_amount > 0 AND EXISTS (
+				SELECT 1 FROM visit_items vi
+				WHERE vi.visit_id = v.id AND vi.deleted_at IS NULL AND vi.amount > 0
+			) THEN 1 ELSE 0 END as converted
+		FROM visits v
+		WHERE v.deleted_at IS NULL AND v.status = @status
+			AND v.visit_date >= @from AND v.visit_date <= @to`
+	params := reports.EntriesParams(dateFrom, dateTo)
+	if consultantID != "" {
+		visitsSQL += ` AND v.consultant_id = @consultant_id`
+		params["consultant_id"] = consultantID
+	}
+	sql := `
+		SELECT cv.consultant_id, cv.customer_type,
+			COUNT(*) as visit_count,
+			COALESCE(SUM(cv.converted), 0) as converted_count,
+			COALESCE(SUM(CASE WHEN cv.converted = 1 THEN cv.total_amount ELSE 0 END), 0) as revenue
+		FROM (` + visitsSQL + `) cv
+		GROUP BY cv.consultant_id, cv.customer_type
+	`
+	if err := db.Raw(sql, params).Scan(&visitRows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+
+	var unassigned, total ConsultantStats
+	stats := make(map[uint]*ConsultantStats)
+	for _, r := range visitRows {
+		s := &unassigned
+		if r.ConsultantID != nil {
+			if stats[*r.ConsultantID] == nil {
+				stats[*r.ConsultantID] = &ConsultantStats{}
+			}
+			s = stats[*r.ConsultantID]
+		}
+		for _, s := range []*ConsultantStats{s, &total} {
+			s.VisitCount += r.VisitCount
+			s.ConvertedCount += r.ConvertedCount
+			s.Revenue += r.Revenue
+			if r.CustomerType == models.CustomerTypeNew {
+				s.FirstVisitRevenue += r.Revenue
+			} else {
+				s.ReturningRevenue += r.Revenue
+			}
+		}
+	}
+
+	// 咨询师业绩取明细分配记录中保存的结果
+	var perfRows []struct {
+		EmployeeID  uint
+		Performance models.Money
+	}
+	perfSQL := `
+		SELECT p.employee_id, COALESCE(SUM(p.performance), 0) as performance
+		FROM (` + reports.PerformanceEntriesSQL + `) p
+		WHERE p.biz_date >= @from AND p.biz_date <= @to AND p.role_in_item = @role`
+	perfParams := reports.EntriesParams(dateFrom, dateTo)
+	perfParams["role"] = models.CommissionRoleConsultant
+	if consultantID != "" {
+		perfSQL += ` AND p.employee_id = @consultant_id`
+		perfParams["consultant_id"] = consultantID
+	}
+	perfSQL += ` GROUP BY p.employee_id`
+	if err := db.Raw(perfSQL, perfParams).Scan(&perfRows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+	for _, r := range perfRows {
+		if stats[r.EmployeeID] == nil {
+			stats[r.EmployeeID] = &ConsultantStats{}
+		}
+		stats[r.EmployeeID].Performance += r.Performance
+		total.Performance += r.Performance
+	}
+
+	ids := make([]uint, 0, len(stats))
+	for id := range stats {
+		ids = append(ids, id)
+	}
+	names := make(map[uint]string)
+	if len(ids) > 0 {
+		var employees []models.Employee
+		db.Unscoped().Select("id", "name").Where("id IN ?", ids).Find(&employees)
+		for _, e := range employees {
+			names[e.ID] = e.Name
+		}
+	}
+
+	rows := make([]ConsultantReportRow, 0, len(stats))
+	for id, s := range stats {
+		s.finish()
+		rows = append(rows, ConsultantReportRow{ConsultantID: id, ConsultantName: names[id], ConsultantStats: *s})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Revenue != rows[j].Revenue {
+			return rows[i].Revenue > rows[j].Revenue
+		}
+		return rows[i].ConsultantID < rows[j].ConsultantID
+	})
+	unassigned.finish()
+	total.finish()
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"date_from":  dateFrom,
+			"date_to":    dateTo,
+			"total":      total,
+			"unassigned": unassigned,
+			"rows":       rows,
+		},
+	})
+}
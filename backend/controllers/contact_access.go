@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"skin-performance/config"
+	"skin-performance/models"
+)
+
+// Contact access action constants
+const (
+	contactActionList   = "list"
+	contactActionDetail = "detail"
+	contactActionReveal = "reveal"
+	contactActionExport = "export"
+)
+
+// CustomerContact 带完整电话的顾客，只返回给有查看联系方式权限的用户
+type CustomerContact struct {
+	models.Customer
+	Phone string `json:"phone"`
+}
+
+// EmployeeContact 带完整电话的员工，只返回给有查看联系方式权限的用户
+type EmployeeContact struct {
+	models.Employee
+	Phone *string `json:"phone,omitempty"`
+}
+
+// canViewContact 当前用户的角色是否有查看联系方式权限（配置项 CONTACT_VIEW_ROLES）
+func canViewContact(c *gin.Context) bool {
+	role, _ := c.Get("role")
+	r, _ := role.(string)
+	if r == "" {
+		return false
+	}
+	for _, allowed := range strings.Split(config.AppConfig.ContactViewRoles, ",") {
+		if strings.TrimSpace(allowed) == r {
+			return true
+		}
+	}
+	return false
+}
+
+// logContactAccess 记录未脱敏电话的读取，每个对象一条
+func logContactAccess(c *gin.Context, subjectType, action string, subjectIDs []uint) error {
+	if len(subjectIDs) == 0 {
+		return nil
+	}
+	username, _ := c.Get("username")
+	role, _ := c.Get("role")
+	name, _ := username.(string)
+	r, _ := role.(string)
+
+	now := time.Now()
+	logs := make([]models.ContactAccessLog, 0, len(subjectIDs))
+	for _, id := range subjectIDs {
+		logs = append(logs, models.ContactAccessLog{
+			UserID:      currentUserID(c),
+			Username:    name,
+			Role:        r,
+			SubjectType: subjectType,
+			SubjectID:   id,
+			Action:      action,
+			Path:        c.Request.URL.Path,
+			IP:          c.ClientIP(),
+			CreatedAt:   &now,
+		})
+	}
+	if err := config.GetDB().Create(&logs).Error; err != nil {
+		log.Printf("记录联系方式访问日志失败: %v", err)
+		return err
+	}
+	return nil
+}
+
+// customerContacts 有查看联系方式权限时输出完整电话并记录访问日志，否则原样输出（电话脱敏）
+// 访问日志写入失败时同样只输出脱敏电话
+func customerContacts(c *gin.Context, action string, customers []models.Customer) interface{} {
+	if len(customers) == 0 || !canViewContact(c) {
+		return customers
+	}
+	ids := make([]uint, len(customers))
+	for i, customer := range customers {
+		ids[i] = customer.ID
+	}
+	if err := logContactAccess(c, models.ContactSubjectCustomer, action, ids); err != nil {
+		return customers
+	}
+
+	result := make([]CustomerContact, len(customers))
+	for i, customer := range customers {
+		result[i] = CustomerContact{Customer: customer, Phone: string(customer.Phone)}
+	}
+	return result
+}
+
+// customerContact 单个顾客的 customerContacts
+func customerContact(c *gin.Context, action string, customer models.Customer) interface{} {
+	if result, ok := customerContacts(c, action, []models.Customer{customer}).([]CustomerContact); ok {
+		return result[0]
+	}
+	return customer
+}
+
+// employeeContacts 同 customerContacts，用于员工
+func employeeContacts(c *gin.Context, action string, employees []models.Employee) interface{} {
+	if len(employees) == 0 || !canViewContact(c) {
+		return employees
+	}
+	var ids []uint
+	for _, employee := range employees {
+		if employee.Phone != nil && *employee.Phone != "" {
+			ids = append(ids, employee.ID)
+		}
+	}
+	if err := logContactAccess(c, models.ContactSubjectEmployee, action, ids); err != nil {
+		return employees
+	}
+
+	result := make([]EmployeeContact, len(employees))
+	for i, employee := range employees {
+		result[i] = EmployeeContact{Employee: employee, Phone: (*string)(employee.Phone)}
+	}
+	return result
+}
+
+// employeeContact 单个员工的 employeeContacts
+func employeeContact(c *gin.Context, action string, employee models.Employee) interface{} {
+	if result, ok := employeeContacts(c, action, []models.Employee{employee}).([]EmployeeContact); ok {
+		return result[0]
+	}
+	return employee
+}
+
+// RevealCustomerPhone 查看顾客完整电话（需查看联系方式权限），用于其他接口中脱敏显示的顾客
+func RevealCustomerPhone(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+	if !canViewContact(c) {
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "没有查看联系方式的权限"})
+		return
+	}
+
+	var customer models.Customer
+	if err := config.GetDB().Select("id", "phone").First(&customer, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "顾客不存在"})
+		return
+	}
+	if err := logContactAccess(c, models.ContactSubjectCustomer, contactActionReveal, []uint{customer.ID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "记录访问日志失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    gin.H{"id": customer.ID, "phone": string(customer.Phone)},
+	})
+}
+
+// ListContactAccessLogs 获取联系方式访问日志
+func ListContactAccessLogs(c *gin.Context) {
+	var logs []models.ContactAccessLog
+	query := config.GetDB().Model(&models.ContactAccessLog{})
+
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if subjectType := c.Query("subject_type"); subjectType != "" {
+		query = query.Where("subject_type = ?", subjectType)
+	}
+	if subjectID := c.Query("subject_id"); subjectID != "" {
+		query = query.Where("subject_id = ?", subjectID)
+	}
+	if startDate := c.Query("start_date"); startDate != "" {
+		query = query.Where("created_at >= ?", startDate)
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		query = query.Where("created_at <= ?", endDate+" 23:59:59")
+	}
+
+	// 分页
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	var total int64
+	query.Count(&total)
+
+	if err := query.Order("id DESC").Limit(pageSize).Offset((page - 1) * pageSize).Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"list":      logs,
+			"total":     total,
+			"page":      page,
+			"page_size": pageSize,
+		},
+	})
+}
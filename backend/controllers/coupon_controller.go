@@ -0,0 +1,246 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"skin-performance/config"
+	"skin-performance/models"
+)
+
+// ListCoupons 获取优惠券列表
+func ListCoupons(c *gin.Context) {
+	var coupons []models.Coupon
+	query := config.GetDB().Model(&models.Coupon{}).Preload("Project")
+
+	if code := c.Query("code"); code != "" {
+		query = query.Where("code LIKE ? OR name LIKE ?", "%"+code+"%", "%"+code+"%")
+	}
+	if projectID := c.Query("project_id"); projectID != "" {
+		query = query.Where("project_id = ?", projectID)
+	}
+	if c.Query("active_only") == "true" {
+		query = query.Where("is_active = ?", true)
+	}
+
+	// 分页
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	var total int64
+	query.Count(&total)
+
+	if err := query.Order("id DESC").Limit(pageSize).Offset((page - 1) * pageSize).Find(&coupons).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"list":      coupons,
+			"total":     total,
+			"page":      page,
+			"page_size": pageSize,
+		},
+	})
+}
+
+// GetCoupon 获取单个优惠券
+func GetCoupon(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	var coupon models.Coupon
+	if err := config.GetDB().Preload("Project").First(&coupon, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "优惠券不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    coupon,
+	})
+}
+
+// CreateCoupon 创建优惠券
+func CreateCoupon(c *gin.Context) {
+	var coupon models.Coupon
+	if err := c.ShouldBindJSON(&coupon); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误"})
+		return
+	}
+	coupon.Code = strings.TrimSpace(coupon.Code)
+	if msg := validateCoupon(config.GetDB(), &coupon); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": msg})
+		return
+	}
+
+	now := time.Now()
+	coupon.CreatedAt = &now
+	coupon.UpdatedAt = &now
+	coupon.UsedCount = 0
+	coupon.IsActive = true
+
+	if err := config.GetDB().Omit("Project").Create(&coupon).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "创建成功",
+		"data":    coupon,
+	})
+}
+
+// UpdateCoupon 更新优惠券，已使用的明细金额不受影响
+func UpdateCoupon(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	var coupon models.Coupon
+	if err := config.GetDB().First(&coupon, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "优惠券不存在"})
+		return
+	}
+
+	var input models.Coupon
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误"})
+		return
+	}
+	// 使用次数由明细维护，不允许直接修改
+	input.UsedCount = 0
+	input.Code = strings.TrimSpace(input.Code)
+
+	merged := coupon
+	if input.Code != "" {
+		merged.Code = input.Code
+	}
+	if input.Name != "" {
+		merged.Name = input.Name
+	}
+	if input.DiscountType != "" {
+		merged.DiscountType = input.DiscountType
+	}
+	if input.DiscountRate != 0 {
+		merged.DiscountRate = input.DiscountRate
+	}
+	if input.DiscountAmount != 0 {
+		merged.DiscountAmount = input.DiscountAmount
+	}
+	if input.MinAmount != 0 {
+		merged.MinAmount = input.MinAmount
+	}
+	if input.ProjectID != nil {
+		merged.ProjectID = input.ProjectID
+	}
+	if input.ValidFrom != nil {
+		merged.ValidFrom = input.ValidFrom
+	}
+	if input.ValidTo != nil {
+		merged.ValidTo = input.ValidTo
+	}
+	if input.UsageLimit != 0 {
+		merged.UsageLimit = input.UsageLimit
+	}
+	if msg := validateCoupon(config.GetDB(), &merged); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": msg})
+		return
+	}
+
+	now := time.Now()
+	input.UpdatedAt = &now
+
+	if err := config.GetDB().Model(&coupon).Omit("Project", "UsedCount").Updates(input).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "更新成功",
+		"data":    coupon,
+	})
+}
+
+// DeleteCoupon 删除优惠券（软删除），已使用的明细保留优惠记录
+func DeleteCoupon(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	if err := config.GetDB().Delete(&models.Coupon{}, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "删除失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "删除成功",
+	})
+}
+
+// validateCoupon 校验优惠券，返回错误信息
+func validateCoupon(db *gorm.DB, coupon *models.Coupon) string {
+	if coupon.Code == "" {
+		return "券码为必填项"
+	}
+	if coupon.Name == "" {
+		return "优惠券名称为必填项"
+	}
+	var count int64
+	db.Model(&models.Coupon{}).Where("code = ? AND id <> ?", coupon.Code, coupon.ID).Count(&count)
+	if count > 0 {
+		return "券码已存在"
+	}
+	switch coupon.DiscountType {
+	case models.DiscountTypePercentage:
+		if coupon.DiscountRate <= 0 || coupon.DiscountRate >= 1 {
+			return "折扣必须大于0且小于1"
+		}
+	case models.DiscountTypeFixed:
+		if coupon.DiscountAmount <= 0 {
+			return "立减金额必须大于0"
+		}
+	default:
+		return "无效的优惠方式"
+	}
+	if coupon.MinAmount < 0 {
+		return "使用门槛不能为负数"
+	}
+	if coupon.ProjectID != nil {
+		db.Model(&models.Project{}).Where("id = ?", *coupon.ProjectID).Count(&count)
+		if count == 0 {
+			return "项目不存在"
+		}
+	}
+	if coupon.ValidFrom != nil && coupon.ValidTo != nil && coupon.ValidTo.Before(*coupon.ValidFrom) {
+		return "有效期结束时间不能早于开始时间"
+	}
+	if coupon.UsageLimit < 0 {
+		return "使用次数上限不能为负数"
+	}
+	return ""
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 	"skin-performance/config"
 	"skin-performance/models"
 )
@@ -13,17 +14,38 @@ import (
 // ListCustomers 获取顾客列表
 func ListCustomers(c *gin.Context) {
 	var customers []models.Customer
-	query := config.GetDB().Model(&models.Customer{})
+	query := config.GetDB().Model(&models.Customer{}).Preload("Channel").Preload("Referrer").Preload("Tags")
+
+	// 筛选条件：指定 segment_id 时使用保存的顾客分组条件
+	filter, msg := parseCustomerFilter(c)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": msg})
+		return
+	}
+	if segmentID := c.Query("segment_id"); segmentID != "" {
+		var segment models.CustomerSegment
+		if err := config.GetDB().First(&segment, segmentID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "顾客分组不存在"})
+			return
+		}
+		filter = segment.Filter
+	}
+	query = applyCustomerFilter(query, filter)
 
 	// 搜索条件
 	if name := c.Query("name"); name != "" {
 		query = query.Where("name LIKE ?", "%"+name+"%")
 	}
+	// 电话加密存储，只能按完整号码或后4位经盲索引查询
 	if phone := c.Query("phone"); phone != "" {
-		query = query.Where("phone LIKE ?", "%"+phone+"%")
+		if digits := models.NormalizePhone(phone); len(digits) == 4 {
+			query = query.Where("phone_suffix_hash = ?", models.PhoneSuffixHash(digits))
+		} else {
+			query = query.Where("phone_hash = ?", models.PhoneHash(digits))
+		}
 	}
-	if customerType := c.Query("customer_type"); customerType != "" {
-		query = query.Where("customer_type = ?", customerType)
+	if referrerID := c.Query("referrer_id"); referrerID != "" {
+		query = query.Where("referrer_id = ?", referrerID)
 	}
 
 	// 分页
@@ -48,7 +70,7 @@ func ListCustomers(c *gin.Context) {
 		"code":    200,
 		"message": "success",
 		"data": gin.H{
-			"list":      customers,
+			"list":      customerContacts(c, contactActionList, customers),
 			"total":     total,
 			"page":      page,
 			"page_size": pageSize,
@@ -65,7 +87,7 @@ func GetCustomer(c *gin.Context) {
 	}
 
 	var customer models.Customer
-	if err := config.GetDB().First(&customer, id).Error; err != nil {
+	if err := config.GetDB().Preload("Channel").Preload("Referrer").Preload("Tags").First(&customer, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "顾客不存在"})
 		return
 	}
@@ -73,7 +95,7 @@ func GetCustomer(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "success",
-		"data":    customer,
+		"data":    customerContact(c, contactActionDetail, customer),
 	})
 }
 
@@ -90,7 +112,19 @@ func CreateCustomer(c *gin.Context) {
 	customer.CreatedAt = &now
 	customer.UpdatedAt = &now
 
-	if err := config.GetDB().Create(&customer).Error; err != nil {
+	// 顾客类型和初诊日期由就诊记录计算
+	customer.CustomerType = nil
+	customer.FirstVisitDate = nil
+	if msg := validateCustomerPhone(config.GetDB(), &customer); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": msg})
+		return
+	}
+	if msg := validateCustomerSource(config.GetDB(), &customer); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": msg})
+		return
+	}
+
+	if err := config.GetDB().Omit("Channel", "Referrer", "Tags").Create(&customer).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建失败: " + err.Error()})
 		return
 	}
@@ -125,8 +159,26 @@ func UpdateCustomer(c *gin.Context) {
 	// 更新时间
 	now := time.Now()
 	input.UpdatedAt = &now
+	// 顾客类型和初诊日期由就诊记录计算，忽略手工输入
+	input.CustomerType = nil
+	input.FirstVisitDate = nil
+	input.ID = customer.ID
+	// 编辑时原样提交的脱敏电话视为未修改
+	if input.Phone.IsMasked() {
+		input.Phone = ""
+	}
+	if input.Phone != "" {
+		if msg := validateCustomerPhone(config.GetDB(), &input); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": msg})
+			return
+		}
+	}
+	if msg := validateCustomerSource(config.GetDB(), &input); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": msg})
+		return
+	}
 
-	if err := config.GetDB().Model(&customer).Updates(input).Error; err != nil {
+	if err := config.GetDB().Model(&customer).Omit("Channel", "Referrer", "Tags").Updates(input).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新失败"})
 		return
 	}
@@ -156,3 +208,47 @@ func DeleteCustomer(c *gin.Context) {
 		"message": "删除成功",
 	})
 }
+
+// validateCustomerPhone 校验顾客电话并设置盲索引，返回错误信息
+// 号码只保留数字；按盲索引检查重复，已删除（含已合并）顾客的号码同样不能再使用
+func validateCustomerPhone(db *gorm.DB, customer *models.Customer) string {
+	if customer.Phone.IsMasked() {
+		return "电话格式不正确"
+	}
+	digits := models.NormalizePhone(string(customer.Phone))
+	if len(digits) < 7 || len(digits) > 20 {
+		return "电话格式不正确"
+	}
+	customer.SetPhone(digits)
+
+	var count int64
+	db.Unscoped().Model(&models.Customer{}).Where("phone_hash = ? AND id <> ?", *customer.PhoneHash, customer.ID).Count(&count)
+	if count > 0 {
+		return "该电话已被其他顾客使用"
+	}
+	return ""
+}
+
+// validateCustomerSource 校验顾客的来源渠道和介绍人，返回错误信息
+func validateCustomerSource(db *gorm.DB, customer *models.Customer) string {
+	if customer.ChannelID != nil {
+		var channel models.Channel
+		if err := db.First(&channel, *customer.ChannelID).Error; err != nil {
+			return "来源渠道不存在"
+		}
+		if !channel.IsActive {
+			return "来源渠道已停用"
+		}
+	}
+	if customer.ReferrerID != nil {
+		if customer.ID != 0 && *customer.ReferrerID == customer.ID {
+			return "介绍人不能是顾客本人"
+		}
+		var count int64
+		db.Model(&models.Customer{}).Where("id = ?", *customer.ReferrerID).Count(&count)
+		if count == 0 {
+			return "介绍人不存在"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"skin-performance/config"
+	"skin-performance/models"
+)
+
+// customerNetSpendSQL 顾客消费金额：已确认单据金额减去退款
+const customerNetSpendSQL = `(
+	(SELECT COALESCE(SUM(sv.total_amount), 0) FROM visits sv
+		WHERE sv.customer_id = customers.id AND sv.deleted_at IS NULL AND sv.status = 'confirmed')
+	- (SELECT COALESCE(SUM(sr.amount), 0) FROM refunds sr
+		JOIN visit_items svi ON svi.id = sr.visit_item_id AND svi.deleted_at IS NULL
+		JOIN visits srv ON srv.id = svi.visit_id AND srv.deleted_at IS NULL
+		WHERE sr.deleted_at IS NULL AND srv.customer_id = customers.id AND srv.status = 'confirmed')
+)`
+
+// customerLastVisitSQL 顾客最近一次已确认单据的就诊时间
+const customerLastVisitSQL = `(SELECT MAX(lv.visit_date) FROM visits lv
+	WHERE lv.customer_id = customers.id AND lv.deleted_at IS NULL AND lv.status = 'confirmed')`
+
+// splitList 拆分逗号分隔的查询参数，去除空白和重复项
+func splitList(s string) []string {
+	var list []string
+	seen := make(map[string]bool)
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" && !seen[v] {
+			seen[v] = true
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// parseCustomerFilter 从查询参数读取顾客筛选条件
+// tags、customer_type 为逗号分隔的列表，tag_mode 为 and（默认）或 or
+func parseCustomerFilter(c *gin.Context) (models.CustomerFilter, string) {
+	f := models.CustomerFilter{
+		Tags:          splitList(c.Query("tags")),
+		TagMode:       c.Query("tag_mode"),
+		CustomerTypes: splitList(c.Query("customer_type")),
+	}
+	if s := c.Query("channel_id"); s != "" {
+		id, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return f, "无效的渠道ID"
+		}
+		channelID := uint(id)
+		f.ChannelID = &channelID
+	}
+	for _, p := range []struct {
+		name string
+		dest **models.Money
+	}{{"spend_min", &f.SpendMin}, {"spend_max", &f.SpendMax}} {
+		if s := c.Query(p.name); s != "" {
+			m, err := models.ParseMoney(s)
+			if err != nil {
+				return f, "无效的消费金额"
+			}
+			*p.dest = &m
+		}
+	}
+	for _, p := range []struct {
+		name string
+		dest **int
+	}{{"last_visit_days_min", &f.LastVisitDaysMin}, {"last_visit_days_max", &f.LastVisitDaysMax}} {
+		if s := c.Query(p.name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return f, "无效的未就诊天数"
+			}
+			*p.dest = &n
+		}
+	}
+	return f, validateCustomerFilter(&f)
+}
+
+// validateCustomerFilter 校验并规范化筛选条件，返回错误信息
+func validateCustomerFilter(f *models.CustomerFilter) string {
+	if f.TagMode == "" {
+		f.TagMode = models.TagModeAnd
+	}
+	if f.TagMode != models.TagModeAnd && f.TagMode != models.TagModeOr {
+		return "标签匹配方式只能为 and 或 or"
+	}
+	if f.SpendMin != nil && f.SpendMax != nil && *f.SpendMin > *f.SpendMax {
+		return "消费金额下限不能大于上限"
+	}
+	if (f.LastVisitDaysMin != nil && *f.LastVisitDaysMin < 0) || (f.LastVisitDaysMax != nil && *f.LastVisitDaysMax < 0) {
+		return "未就诊天数不能为负数"
+	}
+	if f.LastVisitDaysMin != nil && f.LastVisitDaysMax != nil && *f.LastVisitDaysMin > *f.LastVisitDaysMax {
+		return "未就诊天数下限不能大于上限"
+	}
+	return ""
+}
+
+// applyCustomerFilter 将筛选条件加到以 customers 表为主表的查询上
+func applyCustomerFilter(query *gorm.DB, f models.CustomerFilter) *gorm.DB {
+	if len(f.TagIDs) > 0 {
+		tagged := "SELECT ct.customer_id FROM customer_tags ct WHERE ct.tag_id IN ?"
+		if f.TagMode == models.TagModeOr {
+			query = query.Where("customers.id IN ("+tagged+")", f.TagIDs)
+		} else {
+			query = query.Where("customers.id IN ("+tagged+" GROUP BY ct.customer_id HAVING COUNT(DISTINCT ct.tag_id) = ?)", f.TagIDs, len(f.TagIDs))
+		}
+	} else if len(f.Tags) > 0 {
+		tagged := "SELECT ct.customer_id FROM customer_tags ct JOIN tags t ON t.id = ct.tag_id WHERE t.name IN ?"
+		if f.TagMode == models.TagModeOr {
+			query = query.Where("customers.id IN ("+tagged+")", f.Tags)
+		} else {
+			query = query.Where("customers.id IN ("+tagged+" GROUP BY ct.customer_id HAVING COUNT(DISTINCT t.id) = ?)", f.Tags, len(f.Tags))
+		}
+	}
+	if len(f.CustomerTypes) > 0 {
+		query = query.Where("customers.customer_type IN ?", f.CustomerTypes)
+	}
+	if f.ChannelID != nil {
+		query = query.Where("customers.channel_id = ?", *f.ChannelID)
+	}
+	if f.SpendMin != nil {
+		query = query.Where(customerNetSpendSQL+" >= ?", *f.SpendMin)
+	}
+	if f.SpendMax != nil {
+		query = query.Where(customerNetSpendSQL+" <= ?", *f.SpendMax)
+	}
+
+	// 未就诊天数按诊所时区的日期计算：今天就诊为0天
+	today := time.Now().In(config.ClinicLocation())
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, today.Location())
+	if f.LastVisitDaysMin != nil {
+		query = query.Where(customerLastVisitSQL+" < ?", today.AddDate(0, 0, 1-*f.LastVisitDaysMin))
+	}
+	if f.LastVisitDaysMax != nil {
+		query = query.Where(customerLastVisitSQL+" >= ?", today.AddDate(0, 0, -*f.LastVisitDaysMax))
+	}
+	return query
+}
@@ -0,0 +1,399 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"skin-performance/config"
+	"skin-performance/models"
+	"skin-performance/utils"
+)
+
+// DuplicateCandidate 疑似重复的一对顾客
+// Score 为姓名相似度与电话相似度的加权分（0–1），越高越可能是同一人
+type DuplicateCandidate struct {
+	Customer       models.Customer `json:"customer"`
+	Duplicate      models.Customer `json:"duplicate"`
+	NameSimilarity float64         `json:"name_similarity"`
+	PhoneDistance  int             `json:"phone_distance"`
+	Score          float64         `json:"score"`
+	Reasons        []string        `json:"reasons"`
+}
+
+// normalizeName 去除姓名中的空白，用于相似度比较
+func normalizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, name)
+}
+
+// matchDuplicate 判断两位顾客是否疑似重复
+// 姓名相同（同一人使用两个号码）、电话相差不超过1位（录入错误）、或电话相差不超过2位且姓名相似度不低于0.5时视为疑似重复
+func matchDuplicate(a, b *models.Customer) (DuplicateCandidate, bool) {
+	nameA, nameB := normalizeName(a.Name), normalizeName(b.Name)
+	phoneA, phoneB := models.NormalizePhone(string(a.Phone)), models.NormalizePhone(string(b.Phone))
+	nameSim := utils.Similarity(nameA, nameB)
+	phoneDist := utils.EditDistance(phoneA, phoneB)
+
+	var reasons []string
+	if nameA != "" && nameA == nameB {
+		reasons = append(reasons, "姓名相同")
+	}
+	if phoneDist <= 1 {
+		reasons = append(reasons, "电话相差"+strconv.Itoa(phoneDist)+"位")
+	} else if phoneDist <= 2 && nameSim >= 0.5 {
+		reasons = append(reasons, "电话相差2位且姓名相似")
+	}
+	if len(reasons) == 0 {
+		return DuplicateCandidate{}, false
+	}
+
+	score := 0.6*nameSim + 0.4*utils.Similarity(phoneA, phoneB)
+	return DuplicateCandidate{
+		Customer:       *a,
+		Duplicate:      *b,
+		NameSimilarity: nameSim,
+		PhoneDistance:  phoneDist,
+		Score:          float64(int(score*1000+0.5)) / 1000,
+		Reasons:        reasons,
+	}, true
+}
+
+// duplicateBlockingSQL 分桶条件：只比较至少满足其一的两位顾客，避免全量两两比较
+// 电话完全相同、尾号（后4位）相同的用盲索引比较；姓名相同或相似的顾客通常姓氏相同
+const duplicateBlockingSQL = `(a.phone_hash = b.phone_hash OR a.phone_suffix_hash = b.phone_suffix_hash
+	OR LEFT(TRIM(a.name), 1) = LEFT(TRIM(b.name), 1))`
+
+// FindDuplicateCustomers 查找疑似重复的顾客
+// 传 customer_id 时只查找与该顾客疑似重复的顾客；结果按相似分从高到低排序，limit 默认50、最大200
+func FindDuplicateCustomers(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	// 先在数据库中按分桶条件找出候选顾客对，再只加载涉及的顾客逐对比较
+	db := config.GetDB()
+	pairSQL := `SELECT a.id AS a_id, b.id AS b_id FROM customers a
+		JOIN customers b ON b.id > a.id AND b.deleted_at IS NULL AND ` + duplicateBlockingSQL + `
+		WHERE a.deleted_at IS NULL`
+	params := map[string]interface{}{}
+	var targetID uint
+	if customerID := c.Query("customer_id"); customerID != "" {
+		id, err := strconv.ParseUint(customerID, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的顾客ID"})
+			return
+		}
+		var count int64
+		db.Model(&models.Customer{}).Where("id = ?", id).Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "顾客不存在"})
+			return
+		}
+		targetID = uint(id)
+		pairSQL += ` AND (a.id = @id OR b.id = @id)`
+		params["id"] = targetID
+	}
+	var pairs []struct {
+		AID uint
+		BID uint
+	}
+	if err := db.Raw(pairSQL+` ORDER BY a.id, b.id`, params).Scan(&pairs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+
+	ids := make([]uint, 0, len(pairs)*2)
+	for _, pair := range pairs {
+		ids = append(ids, pair.AID, pair.BID)
+	}
+	customers := make(map[uint]*models.Customer)
+	if len(ids) > 0 {
+		var list []models.Customer
+		if err := db.Where("id IN ?", ids).Find(&list).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+			return
+		}
+		for i := range list {
+			customers[list[i].ID] = &list[i]
+		}
+	}
+	candidates := make([]DuplicateCandidate, 0)
+	for _, pair := range pairs {
+		a, b := customers[pair.AID], customers[pair.BID]
+		if a == nil || b == nil {
+			continue
+		}
+		// 查找指定顾客的重复时，该顾客固定为 customer
+		if b.ID == targetID {
+			a, b = b, a
+		}
+		if candidate, ok := matchDuplicate(a, b); ok {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		return candidates[i].Customer.ID < candidates[j].Customer.ID
+	})
+	total := len(candidates)
+	if total > limit {
+		candidates = candidates[:limit]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"list":  candidates,
+			"total": total,
+		},
+	})
+}
+
+// MergeCustomersRequest 顾客合并请求，loser_id 为被合并（删除）的顾客
+type MergeCustomersRequest struct {
+	LoserID uint    `json:"loser_id" binding:"required"`
+	Reason  *string `json:"reason"`
+}
+
+// MergeCustomers 将 loser_id 顾客合并到 :id 顾客（仅管理员）
+// 在同一事务中：就诊和已购疗程改为归属保留顾客，储值余额通过合并流水转入保留顾客，被合并顾客软删除，
+// 重新计算保留顾客的分类，并写入合并记录
+func MergeCustomers(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+	var req MergeCustomersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请选择被合并的顾客"})
+		return
+	}
+	survivorID := uint(id)
+	if req.LoserID == survivorID {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "不能与自身合并"})
+		return
+	}
+
+	tx := config.GetDB().Begin()
+	// 按ID顺序锁定两位顾客，避免并发合并时死锁
+	var customers []models.Customer
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", []uint{survivorID, req.LoserID}).Order("id").Find(&customers).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+	if len(customers) != 2 {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "顾客不存在"})
+		return
+	}
+	survivor, loser := customers[0], customers[1]
+	if survivor.ID != survivorID {
+		survivor, loser = loser, survivor
+	}
+	snapshot, _ := json.Marshal(loser)
+
+	// 就诊和已购疗程（含已删除的记录）改为归属保留顾客
+	var visitIDs, packageIDs []uint
+	if err := tx.Unscoped().Model(&models.Visit{}).Where("customer_id = ?", loser.ID).
+		Order("id").Pluck("id", &visitIDs).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询就诊记录失败"})
+		return
+	}
+	if err := tx.Unscoped().Model(&models.Visit{}).Where("customer_id = ?", loser.ID).
+		UpdateColumn("customer_id", survivorID).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "迁移就诊记录失败"})
+		return
+	}
+	if err := tx.Unscoped().Model(&models.CustomerPackage{}).Where("customer_id = ?", loser.ID).
+		Order("id").Pluck("id", &packageIDs).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询已购疗程失败"})
+		return
+	}
+	if err := tx.Unscoped().Model(&models.CustomerPackage{}).Where("customer_id = ?", loser.ID).
+		UpdateColumn("customer_id", survivorID).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "迁移已购疗程失败"})
+		return
+	}
+
+	// 被合并顾客介绍的顾客改为由保留顾客介绍；保留顾客未填写来源时沿用被合并顾客的来源
+	var referralIDs []uint
+	referrals := tx.Unscoped().Model(&models.Customer{}).Where("referrer_id = ? AND id <> ?", loser.ID, survivorID)
+	if err := referrals.Session(&gorm.Session{}).Order("id").Pluck("id", &referralIDs).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询介绍关系失败"})
+		return
+	}
+	if err := referrals.Session(&gorm.Session{}).UpdateColumn("referrer_id", survivorID).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "迁移介绍关系失败"})
+		return
+	}
+	sourceUpdates := map[string]interface{}{}
+	if survivor.ChannelID == nil && loser.ChannelID != nil {
+		sourceUpdates["channel_id"] = *loser.ChannelID
+	}
+	if survivor.ReferrerID == nil || *survivor.ReferrerID == loser.ID {
+		if loser.ReferrerID != nil && *loser.ReferrerID != survivorID {
+			sourceUpdates["referrer_id"] = *loser.ReferrerID
+		} else if survivor.ReferrerID != nil {
+			sourceUpdates["referrer_id"] = nil
+		}
+	}
+	if len(sourceUpdates) > 0 {
+		if err := tx.Model(&models.Customer{}).Where("id = ?", survivorID).Updates(sourceUpdates).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新顾客来源失败"})
+			return
+		}
+	}
+
+	// 被合并顾客的标签并入保留顾客
+	if err := tx.Exec("INSERT IGNORE INTO customer_tags (customer_id, tag_id) SELECT ?, tag_id FROM customer_tags WHERE customer_id = ?",
+		survivorID, loser.ID).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "合并顾客标签失败"})
+		return
+	}
+
+	// 储值流水只增不改：被合并顾客的流水保留在原账户，余额以一对合并流水转入保留顾客
+	var account models.StoredValueAccount
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("customer_id = ?", loser.ID).Limit(1).Find(&account).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询储值账户失败"})
+		return
+	}
+	var transferred models.Money
+	if account.ID != 0 && account.Balance > 0 {
+		transferred = account.Balance
+		outRemark := "合并至顾客 " + survivor.Name
+		inRemark := "由顾客 " + loser.Name + " 合并转入"
+		entries := []struct {
+			customerID uint
+			entry      models.StoredValueTransaction
+		}{
+			{loser.ID, models.StoredValueTransaction{Type: models.StoredValueMergeOut, Amount: -transferred, Remark: &outRemark, OperatorID: currentUserID(c)}},
+			{survivorID, models.StoredValueTransaction{Type: models.StoredValueMergeIn, Amount: transferred, Remark: &inRemark, OperatorID: currentUserID(c)}},
+		}
+		for _, e := range entries {
+			if _, err := changeStoredValue(tx, e.customerID, e.entry); err != nil {
+				tx.Rollback()
+				if errors.Is(err, errInsufficientBalance) {
+					c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "转移储值余额失败"})
+				return
+			}
+		}
+	}
+
+	if err := tx.Delete(&loser).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "删除被合并顾客失败"})
+		return
+	}
+	if err := refreshCustomerClassification(tx, survivorID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新顾客分类失败"})
+		return
+	}
+
+	movedVisits, _ := json.Marshal(visitIDs)
+	movedPackages, _ := json.Marshal(packageIDs)
+	movedReferrals, _ := json.Marshal(referralIDs)
+	now := time.Now()
+	mergeLog := models.CustomerMergeLog{
+		SurvivorID:         survivorID,
+		LoserID:            loser.ID,
+		LoserSnapshot:      string(snapshot),
+		MovedVisitIDs:      string(movedVisits),
+		MovedPackageIDs:    string(movedPackages),
+		MovedReferralIDs:   string(movedReferrals),
+		TransferredBalance: transferred,
+		Reason:             req.Reason,
+		OperatorID:         currentUserID(c),
+		CreatedAt:          &now,
+	}
+	if err := tx.Omit("Survivor").Create(&mergeLog).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "保存合并记录失败"})
+		return
+	}
+	tx.Commit()
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "合并成功",
+		"data":    mergeLog,
+	})
+}
+
+// ListCustomerMergeLogs 获取顾客合并记录
+func ListCustomerMergeLogs(c *gin.Context) {
+	var logs []models.CustomerMergeLog
+	query := config.GetDB().Model(&models.CustomerMergeLog{}).Preload("Survivor")
+
+	if customerID := c.Query("customer_id"); customerID != "" {
+		query = query.Where("survivor_id = ? OR loser_id = ?", customerID, customerID)
+	}
+	if dateFrom := c.Query("date_from"); dateFrom != "" {
+		query = query.Where("created_at >= ?", dateFrom)
+	}
+	if dateTo := c.Query("date_to"); dateTo != "" {
+		query = query.Where("created_at <= ?", dateTo+" 23:59:59")
+	}
+
+	// 分页
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	var total int64
+	query.Count(&total)
+
+	if err := query.Order("id DESC").Limit(pageSize).Offset((page - 1) * pageSize).Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"list":      logs,
+			"total":     total,
+			"page":      page,
+			"page_size": pageSize,
+		},
+	})
+}
@@ -0,0 +1,240 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"skin-performance/config"
+	"skin-performance/models"
+)
+
+// ListCustomerSegments 获取保存的顾客分组列表
+func ListCustomerSegments(c *gin.Context) {
+	var segments []models.CustomerSegment
+	if err := config.GetDB().Order("name").Find(&segments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+	for i := range segments {
+		fillSegmentTagNames(config.GetDB(), &segments[i].Filter)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    segments,
+	})
+}
+
+// GetCustomerSegment 获取单个顾客分组及当前符合条件的顾客数
+// 分组内的顾客通过 GET /customers?segment_id= 分页查询
+func GetCustomerSegment(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	var segment models.CustomerSegment
+	if err := config.GetDB().First(&segment, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "顾客分组不存在"})
+		return
+	}
+
+	var count int64
+	if err := applyCustomerFilter(config.GetDB().Model(&models.Customer{}), segment.Filter).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+	fillSegmentTagNames(config.GetDB(), &segment.Filter)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"segment":        segment,
+			"customer_count": count,
+		},
+	})
+}
+
+// CreateCustomerSegment 保存顾客分组
+func CreateCustomerSegment(c *gin.Context) {
+	var segment models.CustomerSegment
+	if err := c.ShouldBindJSON(&segment); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误"})
+		return
+	}
+	if msg := validateCustomerSegment(config.GetDB(), &segment); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": msg})
+		return
+	}
+
+	now := time.Now()
+	segment.CreatedAt = &now
+	segment.UpdatedAt = &now
+	segment.CreatedBy = currentUserID(c)
+
+	if err := config.GetDB().Create(&segment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建失败: " + err.Error()})
+		return
+	}
+	fillSegmentTagNames(config.GetDB(), &segment.Filter)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "创建成功",
+		"data":    segment,
+	})
+}
+
+// UpdateCustomerSegment 更新顾客分组的名称、说明和筛选条件
+func UpdateCustomerSegment(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	var segment models.CustomerSegment
+	if err := config.GetDB().First(&segment, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "顾客分组不存在"})
+		return
+	}
+
+	var input models.CustomerSegment
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误"})
+		return
+	}
+	input.ID = segment.ID
+	if msg := validateCustomerSegment(config.GetDB(), &input); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": msg})
+		return
+	}
+
+	updates := map[string]interface{}{
+		"name":        input.Name,
+		"description": input.Description,
+		"filter":      input.Filter,
+		"updated_at":  time.Now(),
+	}
+	if err := config.GetDB().Model(&segment).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新失败"})
+		return
+	}
+	config.GetDB().First(&segment, segment.ID)
+	fillSegmentTagNames(config.GetDB(), &segment.Filter)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "更新成功",
+		"data":    segment,
+	})
+}
+
+// DeleteCustomerSegment 删除顾客分组（软删除）
+func DeleteCustomerSegment(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	if err := config.GetDB().Delete(&models.CustomerSegment{}, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "删除失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "删除成功",
+	})
+}
+
+// validateCustomerSegment 校验顾客分组，返回错误信息
+func validateCustomerSegment(db *gorm.DB, segment *models.CustomerSegment) string {
+	segment.Name = strings.TrimSpace(segment.Name)
+	if segment.Name == "" {
+		return "分组名称为必填项"
+	}
+	var count int64
+	db.Model(&models.CustomerSegment{}).Where("name = ? AND id <> ?", segment.Name, segment.ID).Count(&count)
+	if count > 0 {
+		return "分组名称已存在"
+	}
+
+	f := &segment.Filter
+	f.Tags = splitList(strings.Join(f.Tags, ","))
+	f.CustomerTypes = splitList(strings.Join(f.CustomerTypes, ","))
+	if msg := validateCustomerFilter(f); msg != "" {
+		return msg
+	}
+	if msg := resolveSegmentTags(db, f); msg != "" {
+		return msg
+	}
+	if f.ChannelID != nil {
+		db.Model(&models.Channel{}).Where("id = ?", *f.ChannelID).Count(&count)
+		if count == 0 {
+			return "来源渠道不存在"
+		}
+	}
+	return ""
+}
+
+// resolveSegmentTags 将分组条件中的标签名称换成标签ID保存，返回错误信息
+// 同时提交 tags 和 tag_ids 时取并集；标签必须已存在
+func resolveSegmentTags(db *gorm.DB, f *models.CustomerFilter) string {
+	seen := make(map[uint]bool)
+	ids := make([]uint, 0, len(f.TagIDs)+len(f.Tags))
+	for _, id := range f.TagIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for _, name := range f.Tags {
+		var tag models.Tag
+		db.Where("name = ?", name).Limit(1).Find(&tag)
+		if tag.ID == 0 {
+			return "标签不存在：" + name
+		}
+		if !seen[tag.ID] {
+			seen[tag.ID] = true
+			ids = append(ids, tag.ID)
+		}
+	}
+	if len(ids) > 0 {
+		var count int64
+		db.Model(&models.Tag{}).Where("id IN ?", ids).Count(&count)
+		if int(count) != len(ids) {
+			return "标签不存在"
+		}
+	}
+	f.Tags = nil
+	f.TagIDs = ids
+	return ""
+}
+
+// fillSegmentTagNames 按保存的标签ID填入当前的标签名称，用于返回给前端展示
+func fillSegmentTagNames(db *gorm.DB, f *models.CustomerFilter) {
+	if len(f.TagIDs) == 0 {
+		return
+	}
+	var tags []models.Tag
+	db.Where("id IN ?", f.TagIDs).Find(&tags)
+	names := make(map[uint]string, len(tags))
+	for _, t := range tags {
+		names[t.ID] = t.Name
+	}
+	f.Tags = nil
+	for _, id := range f.TagIDs {
+		if name, ok := names[id]; ok {
+			f.Tags = append(f.Tags, name)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"skin-performance/config"
+	"skin-performance/models"
+)
+
+// Timeline event type constants
+const (
+	TimelineEventVisit              = "visit"
+	TimelineEventItem               = "item"
+	TimelineEventProductConsumption = "product_consumption"
+	TimelineEventRemark             = "remark"
+)
+
+// TimelineEvent 顾客时间线中的一条记录
+// Data 按类型分别为就诊单据、就诊明细（含项目和参与人员）、产品消耗或备注内容
+type TimelineEvent struct {
+	Type        string        `json:"type"`
+	Date        time.Time     `json:"date"`
+	VisitID     uint          `json:"visit_id"`
+	VisitNo     string        `json:"visit_no"`
+	VisitStatus string        `json:"visit_status"`
+	Title       string        `json:"title"`
+	Amount      *models.Money `json:"amount,omitempty"`
+	Data        interface{}   `json:"data,omitempty"`
+}
+
+// FavouriteProject 顾客常做项目
+type FavouriteProject struct {
+	ProjectID   uint         `json:"project_id"`
+	ProjectName string       `json:"project_name"`
+	Count       int64        `json:"count"`
+	Amount      models.Money `json:"amount"`
+}
+
+// CustomerSummary 顾客消费概况，只统计已确认的单据
+type CustomerSummary struct {
+	LifetimeSpend      models.Money       `json:"lifetime_spend"`
+	RefundedAmount     models.Money       `json:"refunded_amount"`
+	NetSpend           models.Money       `json:"net_spend"`
+	VisitCount         int64              `json:"visit_count"`
+	LastVisitDate      *time.Time         `json:"last_visit_date,omitempty"`
+	FavouriteProjects  []FavouriteProject `json:"favourite_projects"`
+	Consultant         *models.Employee   `json:"consultant,omitempty"`
+	StoredValueBalance models.Money       `json:"stored_value_balance"`
+}
+
+// favouriteProjectLimit 概况中返回的常做项目数量
+const favouriteProjectLimit = 5
+
+// GetCustomerTimeline 顾客360视图：按就诊时间倒序合并就诊、明细（含医生护士）、产品消耗和备注，并给出消费概况
+// 时间线包含草稿和作废单据（带 visit_status 标识），概况只统计已确认的单据；咨询师取最近一次有咨询师的就诊
+func GetCustomerTimeline(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	db := config.GetDB()
+	var customer models.Customer
+	if err := db.First(&customer, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "顾客不存在"})
+		return
+	}
+
+	var visits []models.Visit
+	if err := db.Where("customer_id = ?", customer.ID).
+		// 已删除的咨询师、项目和员工仍需显示在历史记录中
+		Preload("Consultant", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("Items.Project", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Preload("Items.Allocations").
+		Preload("Items.Allocations.Employee", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Order("visit_date DESC, id DESC").
+		Find(&visits).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+
+	var itemIDs []uint
+	for _, v := range visits {
+		for _, item := range v.Items {
+			itemIDs = append(itemIDs, item.ID)
+		}
+	}
+	consumptions := make(map[uint][]models.ProductConsumption)
+	if len(itemIDs) > 0 {
+		var rows []models.ProductConsumption
+		if err := db.Where("visit_item_id IN ?", itemIDs).Order("id").Find(&rows).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+			return
+		}
+		for _, r := range rows {
+			consumptions[r.VisitItemID] = append(consumptions[r.VisitItemID], r)
+		}
+	}
+
+	events := make([]TimelineEvent, 0)
+	for i := range visits {
+		v := &visits[i]
+		event := func(eventType, title string, amount *models.Money, data interface{}) TimelineEvent {
+			return TimelineEvent{
+				Type:        eventType,
+				Date:        v.VisitDate,
+				VisitID:     v.ID,
+				VisitNo:     v.VisitID,
+				VisitStatus: v.Status,
+				Title:       title,
+				Amount:      amount,
+				Data:        data,
+			}
+		}
+
+		total := v.TotalAmount
+		events = append(events, event(TimelineEventVisit, "就诊 "+v.VisitID, &total, gin.H{
+			"status":         v.Status,
+			"customer_type":  v.CustomerType,
+			"total_amount":   v.TotalAmount,
+			"paid_amount":    v.PaidAmount,
+			"payment_status": v.PaymentStatus,
+			"consultant":     v.Consultant,
+			"void_reason":    v.VoidReason,
+		}))
+		if v.Remark != nil && *v.Remark != "" {
+			events = append(events, event(TimelineEventRemark, *v.Remark, nil, gin.H{"source": "visit"}))
+		}
+
+		for j := range v.Items {
+			item := &v.Items[j]
+			amount := item.Amount
+			events = append(events, event(TimelineEventItem, item.Project.Name, &amount, item))
+			for _, pc := range consumptions[item.ID] {
+				var pcAmount *models.Money
+				if pc.UnitPrice != nil {
+					a := *pc.UnitPrice * models.Money(pc.Quantity)
+					pcAmount = &a
+				}
+				events = append(events, event(TimelineEventProductConsumption,
+					pc.ProductName+" × "+strconv.Itoa(pc.Quantity), pcAmount, pc))
+			}
+			if item.Remark != nil && *item.Remark != "" {
+				events = append(events, event(TimelineEventRemark, *item.Remark, nil, gin.H{
+					"source":        "visit_item",
+					"visit_item_id": item.ID,
+				}))
+			}
+		}
+	}
+
+	summary, err := customerSummary(db, customer.ID, visits)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"customer": customer,
+			"summary":  summary,
+			"events":   events,
+		},
+	})
+}
+
+// customerSummary 计算顾客消费概况，visits 为按就诊时间倒序排列的全部单据
+func customerSummary(db *gorm.DB, customerID uint, visits []models.Visit) (CustomerSummary, error) {
+	summary := CustomerSummary{FavouriteProjects: []FavouriteProject{}}
+	for i := range visits {
+		v := &visits[i]
+		if v.Status != models.VisitStatusConfirmed {
+			continue
+		}
+		summary.VisitCount++
+		summary.LifetimeSpend += v.TotalAmount
+		if summary.LastVisitDate == nil {
+			summary.LastVisitDate = &v.VisitDate
+		}
+		if summary.Consultant == nil && v.Consultant != nil {
+			summary.Consultant = v.Consultant
+		}
+	}
+
+	if err := db.Table("refunds").
+		Joins("JOIN visit_items ON visit_items.id = refunds.visit_item_id AND visit_items.deleted_at IS NULL").
+		Joins("JOIN visits ON visits.id = visit_items.visit_id AND visits.deleted_at IS NULL").
+		Where("refunds.deleted_at IS NULL AND visits.customer_id = ? AND visits.status = ?", customerID, models.VisitStatusConfirmed).
+		Select("COALESCE(SUM(refunds.amount), 0)").Scan(&summary.RefundedAmount).Error; err != nil {
+		return summary, err
+	}
+	summary.NetSpend = summary.LifetimeSpend - summary.RefundedAmount
+
+	if err := db.Table("visit_items").
+		Joins("JOIN visits ON visits.id = visit_items.visit_id AND visits.deleted_at IS NULL").
+		Joins("JOIN projects ON projects.id = visit_items.project_id").
+		Where("visit_items.deleted_at IS NULL AND visits.customer_id = ? AND visits.status = ?", customerID, models.VisitStatusConfirmed).
+		Select("visit_items.project_id as project_id, projects.name as project_name, COUNT(*) as count, COALESCE(SUM(visit_items.amount), 0) as amount").
+		Group("visit_items.project_id, projects.name").
+		Order("count DESC, amount DESC").Limit(favouriteProjectLimit).
+		Scan(&summary.FavouriteProjects).Error; err != nil {
+		return summary, err
+	}
+
+	var account models.StoredValueAccount
+	if err := db.Where("customer_id = ?", customerID).Limit(1).Find(&account).Error; err != nil {
+		return summary, err
+	}
+	summary.StoredValueBalance = account.Balance
+	return summary, nil
+}
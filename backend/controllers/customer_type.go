@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"skin-performance/models"
+)
+
+// refreshCustomerClassification 根据顾客的就诊记录重新计算每张单据的顾客分类、顾客类型和初诊日期
+// 分类只依据已确认的单据，按就诊日期排序：第一张为初诊；此前单据有过消费（金额大于0）的为再消费，否则为复诊。
+// 草稿单据按此前已确认的单据预先分类，确认后重新计算；作废的单据保留作废前的分类。
+// 顾客类型取最近一张已确认单据的分类，初诊日期取第一张已确认单据的日期，没有已确认单据时清空。
+func refreshCustomerClassification(tx *gorm.DB, customerID uint) error {
+	var visits []models.Visit
+	if err := tx.Select("id", "visit_date", "total_amount", "customer_type", "status").
+		Where("customer_id = ? AND status <> ?", customerID, models.VisitStatusVoided).
+		Order("visit_date, id").Find(&visits).Error; err != nil {
+		return err
+	}
+
+	var customerType *string
+	var firstVisitDate *time.Time
+	consumed := false
+	for i := range visits {
+		visitType := models.CustomerTypeReturn
+		if firstVisitDate == nil {
+			visitType = models.CustomerTypeNew
+		} else if consumed {
+			visitType = models.CustomerTypeRepeat
+		}
+		if visits[i].CustomerType == nil || *visits[i].CustomerType != visitType {
+			if err := tx.Model(&models.Visit{}).Where("id = ?", visits[i].ID).
+				UpdateColumn("customer_type", visitType).Error; err != nil {
+				return err
+			}
+		}
+		if visits[i].Status != models.VisitStatusConfirmed {
+			continue
+		}
+		if firstVisitDate == nil {
+			firstVisitDate = &visits[i].VisitDate
+		}
+		if visits[i].TotalAmount > 0 {
+			consumed = true
+		}
+		customerType = &visitType
+	}
+
+	return tx.Model(&models.Customer{}).Where("id = ?", customerID).Updates(map[string]interface{}{
+		"customer_type":    customerType,
+		"first_visit_date": firstVisitDate,
+	}).Error
+}
+
+// BackfillCustomerClassification 按历史就诊记录回填全部顾客的分类和初诊日期，返回处理的顾客数
+// 每位顾客在单独的事务中处理，可重复执行
+func BackfillCustomerClassification(db *gorm.DB) (int, error) {
+	var customers []models.Customer
+	count := 0
+	err := db.Select("id").FindInBatches(&customers, 500, func(batch *gorm.DB, _ int) error {
+		for _, customer := range customers {
+			if err := db.Transaction(func(tx *gorm.DB) error {
+				return refreshCustomerClassification(tx, customer.ID)
+			}); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	}).Error
+	return count, err
+}
@@ -52,7 +52,7 @@ func ListEmployees(c *gin.Context) {
 		"code":    200,
 		"message": "success",
 		"data": gin.H{
-			"list":      employees,
+			"list":      employeeContacts(c, contactActionList, employees),
 			"total":     total,
 			"page":      page,
 			"page_size": pageSize,
@@ -77,7 +77,7 @@ func GetEmployee(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "success",
-		"data":    employee,
+		"data":    employeeContact(c, contactActionDetail, employee),
 	})
 }
 
@@ -135,6 +135,10 @@ func UpdateEmployee(c *gin.Context) {
 	// 更新时间
 	now := time.Now()
 	input.UpdatedAt = &now
+	// 编辑时原样提交的脱敏电话视为未修改
+	if input.Phone != nil && input.Phone.IsMasked() {
+		input.Phone = nil
+	}
 
 	if err := config.GetDB().Model(&employee).Updates(input).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新失败"})
@@ -0,0 +1,526 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"skin-performance/config"
+	"skin-performance/models"
+)
+
+// errPackageRedeemed 疗程已有消耗，售卖明细不能删除
+var errPackageRedeemed = errors.New("疗程已有消耗记录，不能删除售卖明细")
+
+// errPackageRefundRedeemed 疗程已有消耗，售卖明细不能退款
+var errPackageRefundRedeemed = errors.New("疗程已有消耗记录，不能退款")
+
+// performanceBase 明细计算业绩的基数
+// 普通明细为明细金额。疗程按购买时的业绩确认方式：售卖时确认的，售卖明细按金额计、消耗明细为0；
+// 按次确认的，售卖明细为0、消耗明细按该次分摊的价值计。
+func performanceBase(db *gorm.DB, item *models.VisitItem) (models.Money, error) {
+	switch {
+	case item.CustomerPackageID != nil:
+		var cp models.CustomerPackage
+		if err := db.Unscoped().First(&cp, *item.CustomerPackageID).Error; err != nil {
+			return 0, err
+		}
+		if cp.RecognitionPolicy == models.RecognitionPerSession {
+			return cp.SessionValue(item.PackageSessionNo), nil
+		}
+		return 0, nil
+
+	case item.PackageID != nil:
+		// 已生成顾客疗程时以购买时的确认方式为准，否则取套餐当前配置
+		policy := ""
+		if item.ID != 0 {
+			var cp models.CustomerPackage
+			if err := db.Where("sale_visit_item_id = ?", item.ID).First(&cp).Error; err == nil {
+				policy = cp.RecognitionPolicy
+			}
+		}
+		if policy == "" {
+			var pkg models.Package
+			if err := db.Unscoped().First(&pkg, *item.PackageID).Error; err != nil {
+				return 0, err
+			}
+			policy = pkg.RecognitionPolicy
+		}
+		if policy == models.RecognitionPerSession {
+			return 0, nil
+		}
+		return item.Amount, nil
+	}
+	return item.Amount, nil
+}
+
+// preparePackageItem 校验明细的疗程售卖/消耗，消耗时锁定顾客疗程并扣减一次
+func preparePackageItem(tx *gorm.DB, item *models.VisitItem, visit *models.Visit) ([]FieldError, error) {
+	fieldError := func(field, code, message string) []FieldError {
+		return []FieldError{{Field: field, Code: code, Message: message}}
+	}
+
+	item.PackageSessionNo = 0
+	if item.PackageID != nil && item.CustomerPackageID != nil {
+		return fieldError("customer_package_id", ErrCodePackageMismatch, "同一明细不能既售卖又消耗疗程"), nil
+	}
+
+	if item.PackageID != nil {
+		var pkg models.Package
+		if err := tx.First(&pkg, *item.PackageID).Error; err != nil {
+			return fieldError("package_id", ErrCodeNotFound, "疗程套餐不存在"), nil
+		}
+		if !pkg.IsActive {
+			return fieldError("package_id", ErrCodeInactive, "疗程套餐已停用"), nil
+		}
+		if pkg.ProjectID != item.ProjectID {
+			return fieldError("project_id", ErrCodePackageMismatch, "项目与疗程套餐不一致"), nil
+		}
+	}
+
+	if item.CustomerPackageID != nil {
+		var cp models.CustomerPackage
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&cp, *item.CustomerPackageID).Error; err != nil {
+			return fieldError("customer_package_id", ErrCodeNotFound, "顾客疗程不存在"), nil
+		}
+		if cp.CustomerID != visit.CustomerID {
+			return fieldError("customer_package_id", ErrCodePackageMismatch, "疗程不属于该顾客"), nil
+		}
+		if cp.ProjectID != item.ProjectID {
+			return fieldError("project_id", ErrCodePackageMismatch, "项目与疗程不一致"), nil
+		}
+		if cp.ExpiredAt(visit.VisitDate) {
+			return fieldError("customer_package_id", ErrCodePackageExpired, "疗程已过期"), nil
+		}
+		if cp.RemainingSessions <= 0 {
+			return fieldError("customer_package_id", ErrCodePackageUsedUp, "疗程次数已用完"), nil
+		}
+
+		sessionNo, err := nextPackageSessionNo(tx, &cp)
+		if err != nil {
+			return nil, err
+		}
+		item.PackageSessionNo = sessionNo
+		if err := tx.Model(&cp).Updates(map[string]interface{}{
+			"remaining_sessions": cp.RemainingSessions - 1,
+			"updated_at":         time.Now(),
+		}).Error; err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// createSoldPackage 售卖套餐的明细保存后为顾客生成已购疗程
+// 次数、售价和业绩确认方式在此时固定；有效期从就诊日期起算
+func createSoldPackage(tx *gorm.DB, item *models.VisitItem, visit *models.Visit) error {
+	if item.PackageID == nil {
+		return nil
+	}
+	var pkg models.Package
+	if err := tx.First(&pkg, *item.PackageID).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	cp := models.CustomerPackage{
+		CustomerID:        visit.CustomerID,
+		PackageID:         pkg.ID,
+		ProjectID:         pkg.ProjectID,
+		SaleVisitItemID:   item.ID,
+		TotalSessions:     pkg.Sessions,
+		RemainingSessions: pkg.Sessions,
+		Price:             item.Amount,
+		RecognitionPolicy: pkg.RecognitionPolicy,
+		PurchasedAt:       visit.VisitDate,
+		CreatedAt:         &now,
+		UpdatedAt:         &now,
+	}
+	if pkg.ValidDays > 0 {
+		expiresAt := visit.VisitDate.AddDate(0, 0, pkg.ValidDays)
+		cp.ExpiresAt = &expiresAt
+	}
+	return tx.Create(&cp).Error
+}
+
+// activeRedemptions 有效的疗程消耗明细：明细和单据均未删除，单据未作废
+func activeRedemptions(tx *gorm.DB) *gorm.DB {
+	return tx.Model(&models.VisitItem{}).
+		Joins("JOIN visits ON visits.id = visit_items.visit_id AND visits.deleted_at IS NULL").
+		Where("visits.status <> ?", models.VisitStatusVoided)
+}
+
+// nextPackageSessionNo 顾客疗程下一次消耗的次序号：取有效消耗明细未占用的最小次序
+// 删除或作废的消耗明细会退回次数，其次序号由下一次消耗补上，避免与仍有效的消耗重复
+func nextPackageSessionNo(tx *gorm.DB, cp *models.CustomerPackage) (int, error) {
+	var used []int
+	if err := activeRedemptions(tx).Where("visit_items.customer_package_id = ?", cp.ID).
+		Pluck("visit_items.package_session_no", &used).Error; err != nil {
+		return 0, err
+	}
+	taken := make(map[int]bool, len(used))
+	for _, n := range used {
+		taken[n] = true
+	}
+	n := 1
+	for taken[n] {
+		n++
+	}
+	return n, nil
+}
+
+// soldPackageRedeemed 单据售卖的疗程是否已在其他单据消耗
+func soldPackageRedeemed(tx *gorm.DB, visitID uint) (bool, error) {
+	var count int64
+	err := activeRedemptions(tx).
+		Where("visit_items.visit_id <> ?", visitID).
+		Where("visit_items.customer_package_id IN (?)", tx.Model(&models.CustomerPackage{}).Select("id").
+			Where("sale_visit_item_id IN (?)", tx.Model(&models.VisitItem{}).Select("id").Where("visit_id = ?", visitID))).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// releaseItemPackage 删除明细前撤销其疗程操作：消耗明细退回一次，售卖明细删除未消耗的顾客疗程
+func releaseItemPackage(tx *gorm.DB, item *models.VisitItem) error {
+	if item.CustomerPackageID != nil {
+		if err := tx.Model(&models.CustomerPackage{}).Where("id = ?", *item.CustomerPackageID).
+			Update("remaining_sessions", gorm.Expr("remaining_sessions + 1")).Error; err != nil {
+			return err
+		}
+	}
+
+	if item.PackageID != nil {
+		var cp models.CustomerPackage
+		if err := tx.Where("sale_visit_item_id = ?", item.ID).First(&cp).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		var redeemed int64
+		if err := activeRedemptions(tx).Where("visit_items.customer_package_id = ?", cp.ID).Count(&redeemed).Error; err != nil {
+			return err
+		}
+		if redeemed > 0 {
+			return errPackageRedeemed
+		}
+		if err := tx.Delete(&cp).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cancelSoldPackage 售卖明细退款时作废其顾客疗程的剩余次数，已有消耗时返回 errPackageRefundRedeemed
+// 锁定顾客疗程，避免与并发的消耗同时通过校验
+func cancelSoldPackage(tx *gorm.DB, item *models.VisitItem) error {
+	var cp models.CustomerPackage
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("sale_visit_item_id = ?", item.ID).First(&cp).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	var redeemed int64
+	if err := activeRedemptions(tx).Where("visit_items.customer_package_id = ?", cp.ID).Count(&redeemed).Error; err != nil {
+		return err
+	}
+	if redeemed > 0 {
+		return errPackageRefundRedeemed
+	}
+	return tx.Model(&cp).Updates(map[string]interface{}{
+		"remaining_sessions": 0,
+		"updated_at":         time.Now(),
+	}).Error
+}
+
+// restoreSoldPackage 删除售卖明细的退款时恢复其顾客疗程的次数（退款期间不能消耗，恢复为总次数）
+func restoreSoldPackage(tx *gorm.DB, item *models.VisitItem) error {
+	return tx.Model(&models.CustomerPackage{}).Where("sale_visit_item_id = ?", item.ID).Updates(map[string]interface{}{
+		"remaining_sessions": gorm.Expr("total_sessions"),
+		"updated_at":         time.Now(),
+	}).Error
+}
+
+// ListPackages 获取疗程套餐列表
+func ListPackages(c *gin.Context) {
+	var packages []models.Package
+	query := config.GetDB().Model(&models.Package{}).Preload("Project")
+
+	if name := c.Query("name"); name != "" {
+		query = query.Where("name LIKE ?", "%"+name+"%")
+	}
+	if projectID := c.Query("project_id"); projectID != "" {
+		query = query.Where("project_id = ?", projectID)
+	}
+	if c.Query("active_only") == "true" {
+		query = query.Where("is_active = ?", true)
+	}
+
+	// 分页
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	var total int64
+	query.Count(&total)
+
+	if err := query.Order("id DESC").Limit(pageSize).Offset((page - 1) * pageSize).Find(&packages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"list":      packages,
+			"total":     total,
+			"page":      page,
+			"page_size": pageSize,
+		},
+	})
+}
+
+// GetPackage 获取单个疗程套餐
+func GetPackage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	var pkg models.Package
+	if err := config.GetDB().Preload("Project").First(&pkg, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "疗程套餐不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    pkg,
+	})
+}
+
+// CreatePackage 创建疗程套餐
+func CreatePackage(c *gin.Context) {
+	var pkg models.Package
+	if err := c.ShouldBindJSON(&pkg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误"})
+		return
+	}
+	if pkg.RecognitionPolicy == "" {
+		pkg.RecognitionPolicy = models.RecognitionAtSale
+	}
+	if msg := validatePackage(config.GetDB(), &pkg); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": msg})
+		return
+	}
+
+	now := time.Now()
+	pkg.CreatedAt = &now
+	pkg.UpdatedAt = &now
+	pkg.IsActive = true
+
+	if err := config.GetDB().Omit("Project").Create(&pkg).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "创建成功",
+		"data":    pkg,
+	})
+}
+
+// UpdatePackage 更新疗程套餐，已售出的顾客疗程不受影响
+func UpdatePackage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	var pkg models.Package
+	if err := config.GetDB().First(&pkg, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "疗程套餐不存在"})
+		return
+	}
+
+	var input models.Package
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误"})
+		return
+	}
+
+	merged := pkg
+	if input.Name != "" {
+		merged.Name = input.Name
+	}
+	if input.ProjectID != 0 {
+		merged.ProjectID = input.ProjectID
+	}
+	if input.Sessions != 0 {
+		merged.Sessions = input.Sessions
+	}
+	if input.Price != 0 {
+		merged.Price = input.Price
+	}
+	if input.ValidDays != 0 {
+		merged.ValidDays = input.ValidDays
+	}
+	if input.RecognitionPolicy != "" {
+		merged.RecognitionPolicy = input.RecognitionPolicy
+	}
+	if msg := validatePackage(config.GetDB(), &merged); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": msg})
+		return
+	}
+
+	now := time.Now()
+	input.UpdatedAt = &now
+
+	if err := config.GetDB().Model(&pkg).Omit("Project").Updates(input).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "更新成功",
+		"data":    pkg,
+	})
+}
+
+// DeletePackage 删除疗程套餐（软删除），已售出的顾客疗程仍可继续消耗
+func DeletePackage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	if err := config.GetDB().Delete(&models.Package{}, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "删除失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "删除成功",
+	})
+}
+
+// validatePackage 校验疗程套餐，返回错误信息
+func validatePackage(db *gorm.DB, pkg *models.Package) string {
+	if pkg.Name == "" {
+		return "套餐名称为必填项"
+	}
+	if pkg.ProjectID == 0 {
+		return "请选择项目"
+	}
+	var count int64
+	db.Model(&models.Project{}).Where("id = ?", pkg.ProjectID).Count(&count)
+	if count == 0 {
+		return "项目不存在"
+	}
+	if pkg.Sessions <= 0 {
+		return "次数必须大于0"
+	}
+	if pkg.Price < 0 {
+		return "售价不能为负数"
+	}
+	if pkg.ValidDays < 0 {
+		return "有效天数不能为负数"
+	}
+	if !models.IsRecognitionPolicy(pkg.RecognitionPolicy) {
+		return "无效的业绩确认方式"
+	}
+	return ""
+}
+
+// ListCustomerPackages 获取顾客已购疗程
+// active_only=true 时只返回未过期且有剩余次数的疗程
+func ListCustomerPackages(c *gin.Context) {
+	var packages []models.CustomerPackage
+	query := config.GetDB().Model(&models.CustomerPackage{}).
+		Preload("Customer").Preload("Package").Preload("Project")
+
+	if customerID := c.Query("customer_id"); customerID != "" {
+		query = query.Where("customer_id = ?", customerID)
+	}
+	if projectID := c.Query("project_id"); projectID != "" {
+		query = query.Where("project_id = ?", projectID)
+	}
+	if c.Query("active_only") == "true" {
+		query = query.Where("remaining_sessions > 0 AND (expires_at IS NULL OR expires_at >= ?)", time.Now())
+	}
+
+	// 分页
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	var total int64
+	query.Count(&total)
+
+	if err := query.Order("purchased_at DESC, id DESC").Limit(pageSize).Offset((page - 1) * pageSize).Find(&packages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"list":      packages,
+			"total":     total,
+			"page":      page,
+			"page_size": pageSize,
+		},
+	})
+}
+
+// GetCustomerPackage 获取顾客疗程详情及消耗记录
+func GetCustomerPackage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	var cp models.CustomerPackage
+	if err := config.GetDB().Preload("Customer").Preload("Package").Preload("Project").First(&cp, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "顾客疗程不存在"})
+		return
+	}
+
+	var redemptions []models.VisitItem
+	config.GetDB().Preload("Visit").Preload("Allocations").Preload("Allocations.Employee").
+		Where("customer_package_id = ?", cp.ID).Order("package_session_no").Find(&redemptions)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"package":     cp,
+			"redemptions": redemptions,
+		},
+	})
+}
@@ -0,0 +1,293 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"skin-performance/config"
+	"skin-performance/models"
+)
+
+// refreshVisitPayments 根据收款记录重新计算就诊实收金额和收款状态
+func refreshVisitPayments(tx *gorm.DB, visitID uint) error {
+	var visit models.Visit
+	if err := tx.Select("id", "total_amount").First(&visit, visitID).Error; err != nil {
+		return err
+	}
+	var paidAmount models.Money
+	if err := tx.Model(&models.Payment{}).Where("visit_id = ?", visitID).
+		Select("COALESCE(SUM(amount), 0)").Scan(&paidAmount).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.Visit{}).Where("id = ?", visitID).Updates(map[string]interface{}{
+		"paid_amount":    paidAmount,
+		"payment_status": models.PaymentStatusOf(visit.TotalAmount, paidAmount),
+	}).Error
+}
+
+// ListVisitPayments 获取就诊的收款记录
+func ListVisitPayments(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	var visit models.Visit
+	if err := config.GetDB().First(&visit, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "就诊记录不存在"})
+		return
+	}
+
+	var payments []models.Payment
+	if err := config.GetDB().Where("visit_id = ?", id).Order("paid_at").Find(&payments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"list":               payments,
+			"total_amount":       visit.TotalAmount,
+			"paid_amount":        visit.PaidAmount,
+			"outstanding_amount": visit.OutstandingAmount(),
+			"payment_status":     visit.PaymentStatus,
+		},
+	})
+}
+
+// CreateVisitPayment 登记就诊收款
+// 已作废的单据不能收款，收款金额不能超过未收金额；储值收款同时扣减顾客储值余额
+func CreateVisitPayment(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	var payment models.Payment
+	if err := c.ShouldBindJSON(&payment); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误"})
+		return
+	}
+	if !models.IsPaymentMethod(payment.Method) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的收款方式"})
+		return
+	}
+	if payment.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "收款金额必须大于0"})
+		return
+	}
+
+	now := time.Now()
+	if payment.PaidAt.IsZero() {
+		payment.PaidAt = now
+	}
+	payment.ID = 0
+	payment.VisitID = uint(id)
+	payment.OperatorID = currentUserID(c)
+	payment.CreatedAt = &now
+	payment.UpdatedAt = &now
+
+	tx := config.GetDB().Begin()
+	// 锁定单据，避免并发收款超过未收金额
+	var visit models.Visit
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&visit, id).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "就诊记录不存在"})
+		return
+	}
+	if visit.Status == models.VisitStatusVoided {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "就诊单据已作废，不能收款"})
+		return
+	}
+	if payment.Amount > visit.OutstandingAmount() {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "收款金额超过未收金额" + visit.OutstandingAmount().String(),
+		})
+		return
+	}
+
+	if err := tx.Create(&payment).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建失败"})
+		return
+	}
+	if payment.Method == models.PaymentMethodPrepaid {
+		_, err := changeStoredValue(tx, visit.CustomerID, models.StoredValueTransaction{
+			Type:       models.StoredValueConsume,
+			Amount:     -payment.Amount,
+			VisitID:    &visit.ID,
+			PaymentID:  &payment.ID,
+			OperatorID: payment.OperatorID,
+		})
+		if errors.Is(err, errInsufficientBalance) {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+			return
+		}
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "扣减储值余额失败"})
+			return
+		}
+	}
+	if err := refreshVisitPayments(tx, visit.ID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新收款状态失败"})
+		return
+	}
+	tx.Commit()
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "收款成功",
+		"data":    payment,
+	})
+}
+
+// DeleteVisitPayment 删除收款记录（软删除），储值收款会冲回顾客储值余额
+func DeleteVisitPayment(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+	paymentID, err := strconv.ParseUint(c.Param("payment_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的收款ID"})
+		return
+	}
+
+	// 在事务内锁定收款记录，避免并发删除重复冲回储值余额
+	tx := config.GetDB().Begin()
+	var payment models.Payment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("visit_id = ?", id).First(&payment, paymentID).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "收款记录不存在"})
+		return
+	}
+	result := tx.Delete(&payment)
+	if result.Error != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "删除失败"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "收款记录不存在"})
+		return
+	}
+	if payment.Method == models.PaymentMethodPrepaid {
+		var visit models.Visit
+		if err := tx.Select("id", "customer_id").First(&visit, payment.VisitID).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询就诊记录失败"})
+			return
+		}
+		if _, err := changeStoredValue(tx, visit.CustomerID, models.StoredValueTransaction{
+			Type:       models.StoredValueReverse,
+			Amount:     payment.Amount,
+			VisitID:    &visit.ID,
+			PaymentID:  &payment.ID,
+			OperatorID: currentUserID(c),
+		}); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "冲回储值余额失败"})
+			return
+		}
+	}
+	if err := refreshVisitPayments(tx, payment.VisitID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新收款状态失败"})
+		return
+	}
+	tx.Commit()
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "删除成功",
+	})
+}
+
+// CashReconciliationRow 对账报表行：某天某种收款方式的合计
+// Source 为 visit（就诊收款）或 stored_value（储值充值/退卡，退卡金额为负）
+type CashReconciliationRow struct {
+	Date   string       `json:"date"`
+	Source string       `json:"source"`
+	Method string       `json:"method"`
+	Count  int64        `json:"count"`
+	Amount models.Money `json:"amount"`
+}
+
+// GetCashReconciliationReport 每日收款对账报表，按日期和收款方式汇总
+// 储值收款只是消耗余额，不计入实收（cash_in）；储值充值和退卡按实际支付方式计入
+func GetCashReconciliationReport(c *gin.Context) {
+	dateFrom := c.Query("date_from")
+	dateTo := c.Query("date_to")
+	if dateFrom == "" {
+		dateFrom = time.Now().In(config.ClinicLocation()).Format("2006-01-02")
+	}
+	if dateTo == "" {
+		dateTo = dateFrom
+	}
+
+	var rows []CashReconciliationRow
+	if err := config.GetDB().Model(&models.Payment{}).
+		Select("DATE_FORMAT(paid_at, '%Y-%m-%d') as date, 'visit' as source, method, COUNT(*) as count, COALESCE(SUM(amount), 0) as amount").
+		Where("paid_at >= ? AND paid_at <= ?", dateFrom, dateTo+" 23:59:59").
+		Group("date, method").Order("date, method").
+		Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+
+	var storedValueRows []CashReconciliationRow
+	if err := config.GetDB().Model(&models.StoredValueTransaction{}).
+		Select("DATE_FORMAT(created_at, '%Y-%m-%d') as date, 'stored_value' as source, payment_method as method, COUNT(*) as count, COALESCE(SUM(amount), 0) as amount").
+		Where("type IN ?", []string{models.StoredValueTopUp, models.StoredValueRefund}).
+		Where("created_at >= ? AND created_at <= ?", dateFrom, dateTo+" 23:59:59").
+		Group("date, payment_method").Order("date, payment_method").
+		Scan(&storedValueRows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+	rows = append(rows, storedValueRows...)
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Date < rows[j].Date })
+
+	byMethod := make(map[string]models.Money)
+	var totalAmount, cashIn models.Money
+	for _, r := range rows {
+		byMethod[r.Method] += r.Amount
+		if r.Source == "visit" {
+			totalAmount += r.Amount
+		}
+		if r.Method != models.PaymentMethodPrepaid {
+			cashIn += r.Amount
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"date_from":    dateFrom,
+			"date_to":      dateTo,
+			"total_amount": totalAmount,
+			"cash_in":      cashIn,
+			"by_method":    byMethod,
+			"rows":         rows,
+		},
+	})
+}
@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"skin-performance/models"
+)
+
+// pricingColumns 重新计算价格时需要回写的字段
+var pricingColumns = []string{
+	"list_price", "discount_type", "discount_rate", "discount_amount",
+	"coupon_id", "coupon_code", "approved_by_id", "amount",
+}
+
+// standardPriceOf 明细的标准价：售卖套餐取套餐售价，否则取项目标准价，未设置时为0
+func standardPriceOf(db *gorm.DB, item *models.VisitItem) models.Money {
+	if item.PackageID != nil {
+		var pkg models.Package
+		if err := db.First(&pkg, *item.PackageID).Error; err == nil {
+			return pkg.Price
+		}
+		return 0
+	}
+	var project models.Project
+	if err := db.First(&project, item.ProjectID).Error; err == nil && project.StandardPrice != nil {
+		return *project.StandardPrice
+	}
+	return 0
+}
+
+// priceVisitItem 根据标价和优惠计算明细成交金额，返回字段错误
+// 有标准价时标价固定为标准价；未设置标准价的项目以请求中的标价或成交金额为标价。
+// 未指定优惠方式而成交金额与标价不同时视为手工改价。使用优惠券时锁定优惠券并增加使用次数。
+// 消耗已购疗程的明细不参与定价。
+func priceVisitItem(tx *gorm.DB, item *models.VisitItem) []FieldError {
+	var errs []FieldError
+	add := func(field, code, message string) {
+		errs = append(errs, FieldError{Field: field, Code: code, Message: message})
+	}
+
+	if item.CustomerPackageID != nil {
+		item.ListPrice = 0
+		item.DiscountType = models.DiscountTypeNone
+		item.DiscountRate = 0
+		item.DiscountAmount = 0
+		item.CouponID, item.CouponCode = nil, nil
+		return nil
+	}
+
+	if standard := standardPriceOf(tx, item); standard > 0 {
+		item.ListPrice = standard
+	} else if item.ListPrice <= 0 {
+		item.ListPrice = item.Amount
+	}
+
+	if item.DiscountType != models.DiscountTypeCoupon {
+		item.CouponID, item.CouponCode = nil, nil
+	}
+
+	switch item.DiscountType {
+	case models.DiscountTypeNone, models.DiscountTypeManual:
+		item.DiscountRate = 0
+		if item.Amount == 0 {
+			item.Amount = item.ListPrice
+		}
+		item.DiscountAmount = item.ListPrice - item.Amount
+		item.DiscountType = models.DiscountTypeNone
+		if item.DiscountAmount != 0 {
+			item.DiscountType = models.DiscountTypeManual
+		}
+
+	case models.DiscountTypePercentage:
+		if item.DiscountRate <= 0 || item.DiscountRate > 1 {
+			add("discount_rate", ErrCodeInvalidRatio, "折扣必须大于0且不超过1")
+			return errs
+		}
+		item.Amount = item.ListPrice.MulRatio(item.DiscountRate)
+		item.DiscountAmount = item.ListPrice - item.Amount
+
+	case models.DiscountTypeFixed:
+		item.DiscountRate = 0
+		if item.DiscountAmount < 0 || item.DiscountAmount > item.ListPrice {
+			add("discount_amount", ErrCodeInvalidAmount, "立减金额不能超过标价")
+			return errs
+		}
+		item.Amount = item.ListPrice - item.DiscountAmount
+
+	case models.DiscountTypeCoupon:
+		item.DiscountRate = 0
+		if item.CouponCode == nil || strings.TrimSpace(*item.CouponCode) == "" {
+			add("coupon_code", ErrCodeRequired, "请输入优惠券码")
+			return errs
+		}
+		coupon, msg, code := useCoupon(tx, item)
+		if coupon == nil {
+			add("coupon_code", code, msg)
+			return errs
+		}
+		item.CouponID = &coupon.ID
+		item.CouponCode = &coupon.Code
+		item.DiscountAmount = coupon.Discount(item.ListPrice)
+		item.Amount = item.ListPrice - item.DiscountAmount
+
+	default:
+		add("discount_type", ErrCodeInvalidDiscount, "无效的优惠方式")
+		return errs
+	}
+
+	// 优惠券为预先审批的优惠；其他低于标价的成交需要审批人
+	if item.Amount < item.ListPrice && item.DiscountType != models.DiscountTypeCoupon {
+		if item.ApprovedByID == nil {
+			add("approved_by_id", ErrCodeRequired, "低于标价成交需填写审批人")
+		} else {
+			var approver models.Employee
+			if err := tx.First(&approver, *item.ApprovedByID).Error; err != nil {
+				add("approved_by_id", ErrCodeNotFound, "审批人不存在")
+			} else if !approver.IsActive {
+				add("approved_by_id", ErrCodeInactive, "审批人已停用")
+			}
+		}
+	}
+	return errs
+}
+
+// useCoupon 锁定并核销优惠券，不可用时返回错误信息和错误码
+func useCoupon(tx *gorm.DB, item *models.VisitItem) (*models.Coupon, string, string) {
+	var coupon models.Coupon
+	code := strings.TrimSpace(*item.CouponCode)
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("code = ?", code).First(&coupon).Error; err != nil {
+		return nil, "优惠券不存在", ErrCodeNotFound
+	}
+	if !coupon.IsActive {
+		return nil, "优惠券已停用", ErrCodeInactive
+	}
+
+	usedAt := time.Now()
+	var visit models.Visit
+	if err := tx.Select("id", "visit_date").First(&visit, item.VisitID).Error; err == nil {
+		usedAt = visit.VisitDate
+	}
+	if !coupon.ValidOn(usedAt) {
+		return nil, "优惠券不在有效期内", ErrCodeCouponUnavailable
+	}
+	if coupon.UsageLimit > 0 && coupon.UsedCount >= coupon.UsageLimit {
+		return nil, "优惠券已达使用次数上限", ErrCodeCouponUnavailable
+	}
+	if coupon.ProjectID != nil && *coupon.ProjectID != item.ProjectID {
+		return nil, "优惠券不适用于该项目", ErrCodeCouponUnavailable
+	}
+	if item.ListPrice < coupon.MinAmount {
+		return nil, "未达到优惠券使用门槛" + coupon.MinAmount.String(), ErrCodeCouponUnavailable
+	}
+
+	if err := tx.Model(&coupon).Update("used_count", gorm.Expr("used_count + 1")).Error; err != nil {
+		return nil, "核销优惠券失败", ErrCodeCouponUnavailable
+	}
+	return &coupon, "", ""
+}
+
+// releaseItemCoupon 删除明细或重新定价前退回已核销的优惠券
+func releaseItemCoupon(tx *gorm.DB, item *models.VisitItem) error {
+	if item.CouponID == nil {
+		return nil
+	}
+	return tx.Model(&models.Coupon{}).Where("id = ? AND used_count > 0", *item.CouponID).
+		Update("used_count", gorm.Expr("used_count - 1")).Error
+}
+
+// releaseVisitItem 删除明细前撤销其疗程操作并退回优惠券
+func releaseVisitItem(tx *gorm.DB, item *models.VisitItem) error {
+	if err := releaseItemPackage(tx, item); err != nil {
+		return err
+	}
+	return releaseItemCoupon(tx, item)
+}
@@ -0,0 +1,361 @@
+package controllers
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"skin-performance/config"
+	"skin-performance/models"
+	"skin-performance/reports"
+)
+
+// uncategorizedProject 未设置分类的项目归入的分类名
+const uncategorizedProject = "未分类"
+
+// topDoctorLimit 每个项目或分类列出的医生数
+const topDoctorLimit = 3
+
+// ProjectSalesStats 项目或分类在期间内的成交统计，只统计已确认单据
+// Revenue 按就诊日期统计明细金额，RefundedAmount 按退款日期统计；AvgPrice 为平均成交价（Revenue / ItemCount）
+// PriceRatio 为有标准价的明细成交金额与按标准价计算金额之比，低于1表示整体低于标准价成交
+type ProjectSalesStats struct {
+	Revenue         models.Money `json:"revenue"`
+	RefundedAmount  models.Money `json:"refunded_amount"`
+	NetRevenue      models.Money `json:"net_revenue"`
+	ItemCount       int          `json:"item_count"`
+	CustomerCount   int          `json:"customer_count"`
+	AvgPrice        models.Money `json:"avg_price"`
+	StandardRevenue models.Money `json:"standard_revenue"`
+	PriceRatio      *float64     `json:"price_ratio,omitempty"`
+
+	pricedRevenue models.Money
+}
+
+// finish 计算派生指标
+func (s *ProjectSalesStats) finish() {
+	s.NetRevenue = s.Revenue - s.RefundedAmount
+	if s.ItemCount > 0 {
+		s.AvgPrice = s.Revenue.MulRatio(1 / float64(s.ItemCount))
+	}
+	if s.StandardRevenue > 0 {
+		ratio := float64(int(float64(s.pricedRevenue)/float64(s.StandardRevenue)*10000+0.5)) / 10000
+		s.PriceRatio = &ratio
+	}
+}
+
+// ProjectDoctor 项目或分类下的医生业绩（主操和协同，扣除退款冲减）
+type ProjectDoctor struct {
+	EmployeeID   uint         `json:"employee_id"`
+	EmployeeName string       `json:"employee_name"`
+	Performance  models.Money `json:"performance"`
+	ItemCount    int          `json:"item_count"`
+}
+
+// ProjectPerformanceRow 项目业绩报表行
+type ProjectPerformanceRow struct {
+	ProjectID     uint          `json:"project_id"`
+	ProjectName   string        `json:"project_name"`
+	Category      string        `json:"category"`
+	StandardPrice *models.Money `json:"standard_price,omitempty"`
+	ProjectSalesStats
+	Previous          ProjectSalesStats `json:"previous"`
+	RevenueChangeRate *float64          `json:"revenue_change_rate"`
+	TopDoctors        []ProjectDoctor   `json:"top_doctors"`
+}
+
+// ProjectCategoryRow 项目分类汇总行，CustomerCount 为分类内去重后的顾客数
+type ProjectCategoryRow struct {
+	Category     string `json:"category"`
+	ProjectCount int    `json:"project_count"`
+	ProjectSalesStats
+	Previous          ProjectSalesStats `json:"previous"`
+	RevenueChangeRate *float64          `json:"revenue_change_rate"`
+	TopDoctors        []ProjectDoctor   `json:"top_doctors"`
+}
+
+// changeRate 较上期的变化率，上期为0时为空
+func changeRate(current, previous models.Money) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	rate := float64(int(float64(current-previous)/float64(previous)*10000+0.5)) / 10000
+	return &rate
+}
+
+// projectSalesStats 统计期间内各项目和各分类的成交，dateTo 包含当天
+func projectSalesStats(db *gorm.DB, projects map[uint]*models.Project, dateFrom, dateTo string) (map[uint]*ProjectSalesStats, map[string]*ProjectSalesStats, error) {
+	var itemRows []struct {
+		ProjectID     uint
+		ItemCount     int
+		Revenue       models.Money
+		CustomerCount int
+	}
+	if err := db.Table("visit_items vi").
+		Joins("JOIN visits v ON v.id = vi.visit_id AND v.deleted_at IS NULL").
+		Where("vi.deleted_at IS NULL AND v.status = ?", models.VisitStatusConfirmed).
+		Where("v.visit_date >= ? AND v.visit_date <= ?", dateFrom, dateTo+" 23:59:59").
+		Select("vi.project_id, COUNT(*) as item_count, COALESCE(SUM(vi.amount), 0) as revenue, COUNT(DISTINCT v.customer_id) as customer_count").
+		Group("vi.project_id").Scan(&itemRows).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var refundRows []struct {
+		ProjectID uint
+		Amount    models.Money
+	}
+	if err := db.Table("refunds r").
+		Joins("JOIN visit_items vi ON vi.id = r.visit_item_id AND vi.deleted_at IS NULL").
+		Joins("JOIN visits v ON v.id = vi.visit_id AND v.deleted_at IS NULL").
+		Where("r.deleted_at IS NULL AND v.status = ?", models.VisitStatusConfirmed).
+		Where("r.refund_date >= ? AND r.refund_date <= ?", dateFrom, dateTo+" 23:59:59").
+		Select("vi.project_id, COALESCE(SUM(r.amount), 0) as amount").
+		Group("vi.project_id").Scan(&refundRows).Error; err != nil {
+		return nil, nil, err
+	}
+
+	// 分类内的顾客需跨项目去重，单独统计
+	var categoryRows []struct {
+		CategoryName  string
+		CustomerCount int
+	}
+	if err := db.Table("visit_items vi").
+		Joins("JOIN visits v ON v.id = vi.visit_id AND v.deleted_at IS NULL").
+		Joins("JOIN projects pr ON pr.id = vi.project_id").
+		Where("vi.deleted_at IS NULL AND v.status = ?", models.VisitStatusConfirmed).
+		Where("v.visit_date >= ? AND v.visit_date <= ?", dateFrom, dateTo+" 23:59:59").
+		Select("COALESCE(NULLIF(pr.category, ''), ?) as category_name, COUNT(DISTINCT v.customer_id) as customer_count", uncategorizedProject).
+		Group("category_name").Scan(&categoryRows).Error; err != nil {
+		return nil, nil, err
+	}
+
+	byProject := make(map[uint]*ProjectSalesStats)
+	projectStats := func(id uint) *ProjectSalesStats {
+		if byProject[id] == nil {
+			byProject[id] = &ProjectSalesStats{}
+		}
+		return byProject[id]
+	}
+	for _, r := range itemRows {
+		s := projectStats(r.ProjectID)
+		s.ItemCount, s.Revenue, s.CustomerCount = r.ItemCount, r.Revenue, r.CustomerCount
+		if p := projects[r.ProjectID]; p != nil && p.StandardPrice != nil && *p.StandardPrice > 0 {
+			s.StandardRevenue = *p.StandardPrice * models.Money(r.ItemCount)
+			s.pricedRevenue = r.Revenue
+		}
+	}
+	for _, r := range refundRows {
+		projectStats(r.ProjectID).RefundedAmount = r.Amount
+	}
+
+	byCategory := make(map[string]*ProjectSalesStats)
+	for id, s := range byProject {
+		category := projectCategory(projects[id])
+		if byCategory[category] == nil {
+			byCategory[category] = &ProjectSalesStats{}
+		}
+		c := byCategory[category]
+		c.Revenue += s.Revenue
+		c.RefundedAmount += s.RefundedAmount
+		c.ItemCount += s.ItemCount
+		c.StandardRevenue += s.StandardRevenue
+		c.pricedRevenue += s.pricedRevenue
+		s.finish()
+	}
+	for _, r := range categoryRows {
+		if c := byCategory[r.CategoryName]; c != nil {
+			c.CustomerCount = r.CustomerCount
+		}
+	}
+	for _, c := range byCategory {
+		c.finish()
+	}
+	return byProject, byCategory, nil
+}
+
+// projectCategory 项目所属分类，未设置时为"未分类"
+func projectCategory(p *models.Project) string {
+	if p == nil || p.Category == nil || *p.Category == "" {
+		return uncategorizedProject
+	}
+	return *p.Category
+}
+
+// topDoctors 按业绩从高到低取前 topDoctorLimit 位医生
+func topDoctors(doctors map[uint]*ProjectDoctor) []ProjectDoctor {
+	list := make([]ProjectDoctor, 0, len(doctors))
+	for _, d := range doctors {
+		list = append(list, *d)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Performance != list[j].Performance {
+			return list[i].Performance > list[j].Performance
+		}
+		return list[i].EmployeeID < list[j].EmployeeID
+	})
+	if len(list) > topDoctorLimit {
+		list = list[:topDoctorLimit]
+	}
+	return list
+}
+
+// GetProjectPerformance 获取项目业绩：各项目及分类的成交金额、明细数、顾客数、平均成交价与标准价对比和业绩前列的医生，
+// 并与上一个等长期间对比。可按 category 只看某一分类
+func GetProjectPerformance(c *gin.Context) {
+	dateFrom := c.Query("date_from")
+	dateTo := c.Query("date_to")
+	if dateFrom == "" {
+		dateFrom = time.Now().In(config.ClinicLocation()).AddDate(0, -1, 0).Format("2006-01-02")
+	}
+	if dateTo == "" {
+		dateTo = time.Now().In(config.ClinicLocation()).Format("2006-01-02")
+	}
+	from, err1 := time.ParseInLocation("2006-01-02", dateFrom, config.ClinicLocation())
+	to, err2 := time.ParseInLocation("2006-01-02", dateTo, config.ClinicLocation())
+	if err1 != nil || err2 != nil || to.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的日期范围"})
+		return
+	}
+	// 上期为紧接本期之前、天数相同的期间
+	days := int(to.Sub(from).Hours()/24+0.5) + 1
+	prevTo := from.AddDate(0, 0, -1)
+	prevFrom := prevTo.AddDate(0, 0, 1-days)
+	category := c.Query("category")
+
+	db := config.GetDB()
+	var projectList []models.Project
+	if err := db.Unscoped().Find(&projectList).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+	projects := make(map[uint]*models.Project, len(projectList))
+	for i := range projectList {
+		projects[projectList[i].ID] = &projectList[i]
+	}
+
+	current, currentByCategory, err := projectSalesStats(db, projects, dateFrom, dateTo)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+	previous, previousByCategory, err := projectSalesStats(db, projects, prevFrom.Format("2006-01-02"), prevTo.Format("2006-01-02"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+
+	// 医生业绩取主操和协同的分配业绩，与业绩报表口径一致
+	var doctorRows []struct {
+		ProjectID    uint
+		EmployeeID   uint
+		EmployeeName string
+		Performance  models.Money
+		ItemCount    int
+	}
+	sql := `
+		SELECT vi.project_id, p.employee_id, e.name as employee_name,
+			COALESCE(SUM(p.performance), 0) as performance,
+			COUNT(DISTINCT CASE WHEN p.is_refund = 0 THEN p.visit_item_id END) as item_count
+		FROM (` + reports.PerformanceEntriesSQL + `) p
+		JOIN visit_items vi ON vi.id = p.visit_item_id
+		JOIN employees e ON e.id = p.employee_id
+		WHERE p.biz_date >= @from AND p.biz_date <= @to AND p.role_in_item IN @roles
+		GROUP BY vi.project_id, p.employee_id, e.name
+	`
+	params := reports.EntriesParams(dateFrom, dateTo)
+	params["roles"] = []string{models.CommissionRoleMainDoctor, models.CommissionRoleCoDoctor}
+	if err := db.Raw(sql, params).Scan(&doctorRows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+	projectDoctors := make(map[uint]map[uint]*ProjectDoctor)
+	categoryDoctors := make(map[string]map[uint]*ProjectDoctor)
+	for _, r := range doctorRows {
+		name := projectCategory(projects[r.ProjectID])
+		if projectDoctors[r.ProjectID] == nil {
+			projectDoctors[r.ProjectID] = make(map[uint]*ProjectDoctor)
+		}
+		if categoryDoctors[name] == nil {
+			categoryDoctors[name] = make(map[uint]*ProjectDoctor)
+		}
+		for _, m := range []map[uint]*ProjectDoctor{projectDoctors[r.ProjectID], categoryDoctors[name]} {
+			if m[r.EmployeeID] == nil {
+				m[r.EmployeeID] = &ProjectDoctor{EmployeeID: r.EmployeeID, EmployeeName: r.EmployeeName}
+			}
+			m[r.EmployeeID].Performance += r.Performance
+			m[r.EmployeeID].ItemCount += r.ItemCount
+		}
+	}
+
+	rows := []ProjectPerformanceRow{}
+	projectCount := make(map[string]int)
+	for id, p := range projects {
+		cur, prev := current[id], previous[id]
+		if cur == nil && prev == nil {
+			continue
+		}
+		if category != "" && projectCategory(p) != category {
+			continue
+		}
+		row := ProjectPerformanceRow{
+			ProjectID:     id,
+			ProjectName:   p.Name,
+			Category:      projectCategory(p),
+			StandardPrice: p.StandardPrice,
+			TopDoctors:    topDoctors(projectDoctors[id]),
+		}
+		if cur != nil {
+			row.ProjectSalesStats = *cur
+		}
+		if prev != nil {
+			row.Previous = *prev
+		}
+		row.RevenueChangeRate = changeRate(row.Revenue, row.Previous.Revenue)
+		rows = append(rows, row)
+		projectCount[row.Category]++
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Revenue != rows[j].Revenue {
+			return rows[i].Revenue > rows[j].Revenue
+		}
+		return rows[i].ProjectID < rows[j].ProjectID
+	})
+
+	categories := []ProjectCategoryRow{}
+	for name, count := range projectCount {
+		row := ProjectCategoryRow{
+			Category:     name,
+			ProjectCount: count,
+			TopDoctors:   topDoctors(categoryDoctors[name]),
+		}
+		if cur := currentByCategory[name]; cur != nil {
+			row.ProjectSalesStats = *cur
+		}
+		if prev := previousByCategory[name]; prev != nil {
+			row.Previous = *prev
+		}
+		row.RevenueChangeRate = changeRate(row.Revenue, row.Previous.Revenue)
+		categories = append(categories, row)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if categories[i].Revenue != categories[j].Revenue {
+			return categories[i].Revenue > categories[j].Revenue
+		}
+		return categories[i].Category < categories[j].Category
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"date_from":          dateFrom,
+			"date_to":            dateTo,
+			"previous_date_from": prevFrom.Format("2006-01-02"),
+			"previous_date_to":   prevTo.Format("2006-01-02"),
+			"projects":           rows,
+			"categories":         categories,
+		},
+	})
+}
@@ -0,0 +1,319 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"skin-performance/config"
+	"skin-performance/models"
+)
+
+// buildRefundAllocations 按退款金额占明细金额的比例，为原参与人员生成负数业绩
+// 各人冲减额分别四舍五入到分，尾差由主操医生承担，保证冲减合计等于原业绩合计按比例折算的结果
+func buildRefundAllocations(item *models.VisitItem, refund *models.Refund) []models.RefundAllocation {
+	allocations := make([]models.RefundAllocation, 0, len(item.Allocations))
+	var original, clawback models.Money
+	mainIndex := -1
+	for _, a := range item.Allocations {
+		performance := -a.Performance.Prorate(refund.Amount, item.Amount)
+		original += a.Performance
+		clawback += performance
+		if a.RoleInItem == models.CommissionRoleMainDoctor {
+			mainIndex = len(allocations)
+		}
+		allocations = append(allocations, models.RefundAllocation{
+			RefundID:    refund.ID,
+			VisitItemID: item.ID,
+			EmployeeID:  a.EmployeeID,
+			RoleInItem:  a.RoleInItem,
+			Ratio:       a.Ratio,
+			Performance: performance,
+			CreatedAt:   refund.CreatedAt,
+			UpdatedAt:   refund.CreatedAt,
+		})
+	}
+	if mainIndex >= 0 {
+		allocations[mainIndex].Performance += -original.Prorate(refund.Amount, item.Amount) - clawback
+	}
+	return allocations
+}
+
+// rebuildRefundAllocations 明细业绩重算后，按新的分配记录重新生成各退款的冲减业绩
+func rebuildRefundAllocations(tx *gorm.DB, item *models.VisitItem, refunds []models.Refund) error {
+	for i := range refunds {
+		refund := &refunds[i]
+		if err := tx.Where("refund_id = ?", refund.ID).Delete(&models.RefundAllocation{}).Error; err != nil {
+			return err
+		}
+		allocations := buildRefundAllocations(item, refund)
+		if len(allocations) == 0 {
+			continue
+		}
+		now := time.Now()
+		for j := range allocations {
+			allocations[j].CreatedAt = &now
+			allocations[j].UpdatedAt = &now
+		}
+		if err := tx.Create(&allocations).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refundedAmount 明细已退款的金额合计
+func refundedAmount(db *gorm.DB, visitItemID uint) models.Money {
+	var total models.Money
+	db.Model(&models.Refund{}).Where("visit_item_id = ?", visitItemID).
+		Select("COALESCE(SUM(amount), 0)").Scan(&total)
+	return total
+}
+
+// ListRefunds 获取退款列表
+func ListRefunds(c *gin.Context) {
+	var refunds []models.Refund
+	query := config.GetDB().Model(&models.Refund{}).
+		Preload("VisitItem").Preload("VisitItem.Project").
+		Preload("Allocations").Preload("Allocations.Employee")
+
+	if visitItemID := c.Query("visit_item_id"); visitItemID != "" {
+		query = query.Where("visit_item_id = ?", visitItemID)
+	}
+	if dateFrom := c.Query("date_from"); dateFrom != "" {
+		query = query.Where("refund_date >= ?", dateFrom)
+	}
+	if dateTo := c.Query("date_to"); dateTo != "" {
+		query = query.Where("refund_date <= ?", dateTo+" 23:59:59")
+	}
+
+	// 分页
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	var total int64
+	query.Count(&total)
+
+	if err := query.Order("refund_date DESC, id DESC").Limit(pageSize).Offset((page - 1) * pageSize).Find(&refunds).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"list":      refunds,
+			"total":     total,
+			"page":      page,
+			"page_size": pageSize,
+		},
+	})
+}
+
+// GetRefund 获取单个退款
+func GetRefund(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	var refund models.Refund
+	if err := config.GetDB().Preload("VisitItem").Preload("VisitItem.Project").
+		Preload("Allocations").Preload("Allocations.Employee").First(&refund, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "退款记录不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    refund,
+	})
+}
+
+// CreateRefund 创建退款
+// 只能对已确认单据的明细退款，累计退款不能超过明细金额；退款日期默认当天，不能早于就诊日期，且所在月份不能已结算
+// 售卖疗程的明细只能在疗程未消耗时全额退款，退款后疗程剩余次数清零
+func CreateRefund(c *gin.Context) {
+	var refund models.Refund
+	if err := c.ShouldBindJSON(&refund); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误"})
+		return
+	}
+
+	if refund.VisitItemID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请选择退款的明细"})
+		return
+	}
+	if refund.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "退款金额必须大于0"})
+		return
+	}
+
+	now := time.Now()
+	if refund.RefundDate.IsZero() {
+		refund.RefundDate = now
+	}
+	refund.ID = 0
+	refund.OperatorID = currentUserID(c)
+	refund.CreatedAt = &now
+	refund.UpdatedAt = &now
+	refund.Allocations = nil
+
+	tx := config.GetDB().Begin()
+	var item models.VisitItem
+	// 锁定明细，避免并发退款同时通过可退金额校验
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Visit").Preload("Allocations").
+		First(&item, refund.VisitItemID).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "明细记录不存在"})
+		return
+	}
+	if item.Visit.Status != models.VisitStatusConfirmed {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "只能对已确认的就诊单据退款"})
+		return
+	}
+	if refund.RefundDate.Before(item.Visit.VisitDate) {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "退款日期不能早于就诊日期"})
+		return
+	}
+	settled, err := monthSettled(tx, refund.RefundDate)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询结算记录失败"})
+		return
+	}
+	if settled {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "退款日期所在月份已结算"})
+		return
+	}
+	if refunded := refundedAmount(tx, item.ID); refunded+refund.Amount > item.Amount {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "退款金额超过可退金额" + (item.Amount - refunded).String(),
+		})
+		return
+	}
+
+	// 售卖疗程的明细只能在未消耗时全额退款，退款同时作废疗程剩余次数
+	if item.PackageID != nil {
+		if refunded := refundedAmount(tx, item.ID); refunded+refund.Amount != item.Amount {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "疗程售卖明细需全额退款，可退金额" + (item.Amount - refunded).String(),
+			})
+			return
+		}
+		if err := cancelSoldPackage(tx, &item); err != nil {
+			tx.Rollback()
+			if errors.Is(err, errPackageRefundRedeemed) {
+				c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "作废疗程次数失败"})
+			return
+		}
+	}
+
+	if err := tx.Omit("Allocations").Create(&refund).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建失败"})
+		return
+	}
+	refund.Allocations = buildRefundAllocations(&item, &refund)
+	if len(refund.Allocations) > 0 {
+		if err := tx.Create(&refund.Allocations).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "保存业绩冲减失败"})
+			return
+		}
+	}
+	tx.Commit()
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "创建成功",
+		"data":    refund,
+	})
+}
+
+// DeleteRefund 删除退款（软删除），同时撤销对应的业绩冲减，售卖疗程的明细恢复疗程次数
+// 只能删除已确认单据的退款，退款日期所在月份已结算时不能删除
+func DeleteRefund(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	tx := config.GetDB().Begin()
+	var refund models.Refund
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&refund, id).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "退款记录不存在"})
+		return
+	}
+	var item models.VisitItem
+	if err := tx.Preload("Visit").First(&item, refund.VisitItemID).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "明细记录不存在"})
+		return
+	}
+	if item.Visit.Status != models.VisitStatusConfirmed {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "只能删除已确认就诊单据的退款"})
+		return
+	}
+	settled, err := monthSettled(tx, refund.RefundDate)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询结算记录失败"})
+		return
+	}
+	if settled {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "退款日期所在月份已结算，不能删除"})
+		return
+	}
+
+	if err := tx.Where("refund_id = ?", refund.ID).Delete(&models.RefundAllocation{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "删除业绩冲减失败"})
+		return
+	}
+	if err := tx.Delete(&refund).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "删除失败"})
+		return
+	}
+	if item.PackageID != nil {
+		if err := restoreSoldPackage(tx, &item); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "恢复疗程次数失败"})
+			return
+		}
+	}
+	tx.Commit()
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "删除成功",
+	})
+}
@@ -12,11 +12,11 @@ import (
 
 // RegisterRequest 注册请求
 type RegisterRequest struct {
-	Username string  `json:"username" binding:"required,min=3,max=32"`
-	Password string  `json:"password" binding:"required,min=6"`
-	Role     string  `json:"role" binding:"required"`
-	Name     string  `json:"name" binding:"required"`
-	Phone    *string `json:"phone"`
+	Username string        `json:"username" binding:"required,min=3,max=32"`
+	Password string        `json:"password" binding:"required,min=6"`
+	Role     string        `json:"role" binding:"required"`
+	Name     string        `json:"name" binding:"required"`
+	Phone    *models.Phone `json:"phone"`
 }
 
 // Register 用户注册（初始管理员创建）
@@ -2,116 +2,418 @@ package controllers
 
 import (
 	"net/http"
+	"sort"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"skin-performance/config"
+	"skin-performance/models"
+	"skin-performance/reports"
 )
 
-// PerformanceReport 业绩报表响应
-type PerformanceReport struct {
-	EmployeeID       uint    `json:"employee_id"`
-	EmployeeName     string  `json:"employee_name"`
-	EmployeeRole     string  `json:"employee_role"`
-	MainPerformance  float64 `json:"main_performance"`
-	CoPerformance    float64 `json:"co_performance"`
-	NursePerformance float64 `json:"nurse_performance"`
-	TotalPerformance float64 `json:"total_performance"`
-}
-
 // GetPerformanceReport 获取业绩报表
+// 汇总规则见 reports.BuildPerformanceReport
 func GetPerformanceReport(c *gin.Context) {
 	dateFrom := c.Query("date_from")
 	dateTo := c.Query("date_to")
 	if dateFrom == "" {
-		dateFrom = time.Now().AddDate(0, -1, 0).Format("2006-01-02")
+		dateFrom = time.Now().In(config.ClinicLocation()).AddDate(0, -1, 0).Format("2006-01-02")
 	}
 	if dateTo == "" {
-		dateTo = time.Now().Format("2006-01-02")
+		dateTo = time.Now().In(config.ClinicLocation()).Format("2006-01-02")
+	}
+	period, err := reports.NewPeriod(dateFrom, dateTo, config.ClinicLocation())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+
+	dataset, err := reports.LoadPerformanceDataset(config.GetDB(), period)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+	report := reports.BuildPerformanceReport(dataset, period)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"date_from":                 dateFrom,
+			"date_to":                   dateTo,
+			"total_amount":              report.TotalAmount,
+			"refunded_amount":           report.RefundedAmount,
+			"net_amount":                report.NetAmount,
+			"amount_by_customer_type":   report.AmountByCustomerType,
+			"new_customer_amount":       report.NewCustomerAmount(),
+			"returning_customer_amount": report.ReturningCustomerAmount(),
+			"total_performance":         report.TotalPerformance,
+			"reports":                   report.Employees,
+		},
+	})
+}
+
+// RolePerformance 按员工在明细中的角色拆分的业绩
+type RolePerformance struct {
+	MainPerformance       models.Money `json:"main_performance"`
+	CoPerformance         models.Money `json:"co_performance"`
+	NursePerformance      models.Money `json:"nurse_performance"`
+	ConsultantPerformance models.Money `json:"consultant_performance"`
+	TotalPerformance      models.Money `json:"total_performance"`
+}
+
+func (r *RolePerformance) add(roleInItem string, performance models.Money) {
+	switch roleInItem {
+	case models.CommissionRoleMainDoctor:
+		r.MainPerformance += performance
+	case models.CommissionRoleCoDoctor:
+		r.CoPerformance += performance
+	case models.CommissionRoleNurse:
+		r.NursePerformance += performance
+	case models.CommissionRoleConsultant:
+		r.ConsultantPerformance += performance
+	}
+	r.TotalPerformance += performance
+}
+
+// EmployeePerformanceSummary 员工期间业绩汇总
+// 各角色业绩及 TotalPerformance 为扣除退款后的净业绩，RefundedPerformance 为期间内退款冲减的业绩（负数）
+type EmployeePerformanceSummary struct {
+	RolePerformance
+	GrossPerformance    models.Money `json:"gross_performance"`
+	RefundedPerformance models.Money `json:"refunded_performance"`
+	ItemCount           int          `json:"item_count"`
+}
+
+// EmployeePerformanceDay 员工某天的业绩（退款冲减计入退款日期）
+type EmployeePerformanceDay struct {
+	Date string `json:"date"`
+	RolePerformance
+}
+
+// EmployeePerformanceProject 员工某项目的业绩，ItemCount 为参与的明细数（不含退款）
+type EmployeePerformanceProject struct {
+	ProjectID   uint    `json:"project_id"`
+	ProjectName string  `json:"project_name"`
+	Category    *string `json:"category,omitempty"`
+	ItemCount   int     `json:"item_count"`
+	RolePerformance
+}
+
+// EmployeePerformanceItem 员工业绩明细行：一条明细分配业绩，或一条退款冲减（IsRefund，业绩为负数）
+// Ratio 为员工在该明细中的分配比例，Performance 为按比例分得的业绩
+type EmployeePerformanceItem struct {
+	BizDate      time.Time    `json:"biz_date"`
+	IsRefund     bool         `json:"is_refund"`
+	RefundID     *uint        `json:"refund_id,omitempty"`
+	VisitID      uint         `json:"visit_id"`
+	VisitNo      string       `json:"visit_no"`
+	VisitDate    time.Time    `json:"visit_date"`
+	CustomerID   uint         `json:"customer_id"`
+	CustomerName string       `json:"customer_name"`
+	VisitItemID  uint         `json:"visit_item_id"`
+	ProjectID    uint         `json:"project_id"`
+	ProjectName  string       `json:"project_name"`
+	Category     *string      `json:"category,omitempty"`
+	ItemAmount   models.Money `json:"item_amount"`
+	RoleInItem   string       `json:"role_in_item"`
+	Ratio        float64      `json:"ratio"`
+	Performance  models.Money `json:"performance"`
+}
+
+// GetEmployeePerformance 获取员工业绩：按天、按项目拆分各角色业绩，并列出逐条明细供核对
+// 未传 employee_id 时查询当前登录用户对应的员工；与业绩报表口径一致，只统计已确认单据，退款冲减计入退款日期
+func GetEmployeePerformance(c *gin.Context) {
+	var employeeID uint64
+	if s := c.Query("employee_id"); s != "" {
+		id, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的员工ID"})
+			return
+		}
+		employeeID = id
+	} else if v, ok := c.Get("employeeID"); ok {
+		if own, _ := v.(*uint); own != nil {
+			employeeID = uint64(*own)
+		}
+	}
+	if employeeID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的员工ID"})
+		return
+	}
+
+	dateFrom := c.Query("date_from")
+	dateTo := c.Query("date_to")
+	if dateFrom == "" {
+		dateFrom = time.Now().In(config.ClinicLocation()).AddDate(0, -1, 0).Format("2006-01-02")
+	}
+	if dateTo == "" {
+		dateTo = time.Now().In(config.ClinicLocation()).Format("2006-01-02")
+	}
+	period, err := reports.NewPeriod(dateFrom, dateTo, config.ClinicLocation())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
 	}
 
 	db := config.GetDB()
+	var employee models.Employee
+	if err := db.Unscoped().First(&employee, employeeID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "员工不存在"})
+		return
+	}
 
-	var reports []PerformanceReport
+	var items []EmployeePerformanceItem
 	sql := `
-		SELECT 
-			e.id as employee_id,
-			e.name as employee_name,
-			e.role as employee_role,
-			COALESCE(SUM(CASE WHEN vi.main_doctor_id = e.id THEN vi.amount ELSE 0 END), 0) as main_performance,
-			COALESCE(SUM(CASE WHEN vi.co_doctor1_id = e.id THEN vi.amount * vi.co_ratio1 
-							  WHEN vi.co_doctor2_id = e.id THEN vi.amount * vi.co_ratio2 ELSE 0 END), 0) as co_performance,
-			COALESCE(SUM(CASE WHEN vi.nurse1_id = e.id OR vi.nurse2_id = e.id THEN vi.amount * 0.05 ELSE 0 END), 0) as nurse_performance
-		FROM employees e
-		LEFT JOIN visit_items vi ON (e.id = vi.main_doctor_id OR e.id = vi.co_doctor1_id OR e.id = vi.co_doctor2_id 
-									 OR e.id = vi.nurse1_id OR e.id = vi.nurse2_id)
-		LEFT JOIN visits v ON vi.visit_id = v.id AND v.visit_date >= ? AND v.visit_date <= ?
-		WHERE e.is_active = ?
-		GROUP BY e.id, e.name, e.role
-		HAVING main_performance > 0 OR co_performance > 0 OR nurse_performance > 0
-		ORDER BY (main_performance + co_performance + nurse_performance) DESC
+		SELECT
+			p.biz_date, p.is_refund, NULLIF(p.refund_id, 0) as refund_id,
+			v.id as visit_id, v.visit_id as visit_no, v.visit_date, v.customer_id, cu.name as customer_name,
+			vi.id as visit_item_id, pr.id as project_id, pr.name as project_name, pr.category as category,
+			vi.amount as item_amount, p.role_in_item, p.ratio, p.performance
+		FROM (` + reports.PerformanceEntriesSQL + `) p
+		JOIN visit_items vi ON vi.id = p.visit_item_id
+		JOIN visits v ON v.id = vi.visit_id
+		JOIN customers cu ON cu.id = v.customer_id
+		JOIN projects pr ON pr.id = vi.project_id
+		WHERE p.employee_id = @employee AND p.biz_date >= @from AND p.biz_date <= @to
+		ORDER BY p.biz_date, v.id, vi.id, p.is_refund
 	`
-
-	if err := db.Raw(sql, dateFrom, dateTo+" 23:59:59", true).Scan(&reports).Error; err != nil {
+	params := reports.EntriesParams(period.From.Format("2006-01-02"), period.To.Format("2006-01-02"))
+	params["employee"] = employeeID
+	if err := db.Raw(sql, params).Scan(&items).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
 		return
 	}
 
-	var totalAmount float64
-	db.Table("visit_items").Joins("JOIN visits ON visits.id = visit_items.visit_id").
-		Where("visits.visit_date >= ? AND visits.visit_date <= ?", dateFrom, dateTo+" 23:59:59").
-		Select("COALESCE(SUM(amount), 0)").Scan(&totalAmount)
+	var summary EmployeePerformanceSummary
+	byDay := []EmployeePerformanceDay{}
+	byProject := []EmployeePerformanceProject{}
+	dayIndex := make(map[string]int)
+	projectIndex := make(map[uint]int)
+	for _, item := range items {
+		summary.add(item.RoleInItem, item.Performance)
+		if item.IsRefund {
+			summary.RefundedPerformance += item.Performance
+		} else {
+			summary.GrossPerformance += item.Performance
+			summary.ItemCount++
+		}
+
+		date := item.BizDate.Format("2006-01-02")
+		i, ok := dayIndex[date]
+		if !ok {
+			i = len(byDay)
+			dayIndex[date] = i
+			byDay = append(byDay, EmployeePerformanceDay{Date: date})
+		}
+		byDay[i].add(item.RoleInItem, item.Performance)
 
-	for i := range reports {
-		reports[i].TotalPerformance = reports[i].MainPerformance + reports[i].CoPerformance + reports[i].NursePerformance
+		j, ok := projectIndex[item.ProjectID]
+		if !ok {
+			j = len(byProject)
+			projectIndex[item.ProjectID] = j
+			byProject = append(byProject, EmployeePerformanceProject{
+				ProjectID:   item.ProjectID,
+				ProjectName: item.ProjectName,
+				Category:    item.Category,
+			})
+		}
+		byProject[j].add(item.RoleInItem, item.Performance)
+		if !item.IsRefund {
+			byProject[j].ItemCount++
+		}
+	}
+	sort.SliceStable(byProject, func(a, b int) bool {
+		return byProject[a].TotalPerformance > byProject[b].TotalPerformance
+	})
+	if items == nil {
+		items = []EmployeePerformanceItem{}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "success",
 		"data": gin.H{
-			"date_from":    dateFrom,
-			"date_to":      dateTo,
-			"total_amount": totalAmount,
-			"reports":      reports,
+			"employee_id":   employee.ID,
+			"employee_name": employee.Name,
+			"employee_role": employee.Role,
+			"date_from":     dateFrom,
+			"date_to":       dateTo,
+			"summary":       summary,
+			"by_day":        byDay,
+			"by_project":    byProject,
+			"items":         items,
 		},
 	})
 }
 
-// GetEmployeePerformance 获取员工业绩
-func GetEmployeePerformance(c *gin.Context) {
-	employeeID, err := strconv.ParseUint(c.Query("employee_id"), 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的员工ID"})
-		return
-	}
+// BelowStandardPriceRow 低于标价成交报表行：某咨询师、某审批人名下的低价成交汇总
+type BelowStandardPriceRow struct {
+	ConsultantID   *uint        `json:"consultant_id"`
+	ConsultantName string       `json:"consultant_name"`
+	ApprovedByID   *uint        `json:"approved_by_id"`
+	ApprovedByName string       `json:"approved_by_name"`
+	ItemCount      int64        `json:"item_count"`
+	ListAmount     models.Money `json:"list_amount"`
+	Amount         models.Money `json:"amount"`
+	DiscountAmount models.Money `json:"discount_amount"`
+	CouponCount    int64        `json:"coupon_count"`
+}
 
+// GetBelowStandardPriceReport 低于标价成交报表，按咨询师和审批人汇总
+// 只统计已确认单据中成交金额低于标价的明细；优惠券优惠无审批人，单独成行
+func GetBelowStandardPriceReport(c *gin.Context) {
 	dateFrom := c.Query("date_from")
 	dateTo := c.Query("date_to")
 	if dateFrom == "" {
-		dateFrom = time.Now().AddDate(0, -1, 0).Format("2006-01-02")
+		dateFrom = time.Now().In(config.ClinicLocation()).AddDate(0, -1, 0).Format("2006-01-02")
 	}
 	if dateTo == "" {
-		dateTo = time.Now().Format("2006-01-02")
+		dateTo = time.Now().In(config.ClinicLocation()).Format("2006-01-02")
+	}
+
+	query := config.GetDB().Table("visit_items vi").
+		Joins("JOIN visits v ON v.id = vi.visit_id AND v.deleted_at IS NULL").
+		Joins("LEFT JOIN employees ce ON ce.id = v.consultant_id").
+		Joins("LEFT JOIN employees ae ON ae.id = vi.approved_by_id").
+		Where("vi.deleted_at IS NULL AND v.status = ?", models.VisitStatusConfirmed).
+		Where("vi.amount < vi.list_price").
+		Where("v.visit_date >= ? AND v.visit_date <= ?", dateFrom, dateTo+" 23:59:59")
+	if consultantID := c.Query("consultant_id"); consultantID != "" {
+		query = query.Where("v.consultant_id = ?", consultantID)
+	}
+	if approvedByID := c.Query("approved_by_id"); approvedByID != "" {
+		query = query.Where("vi.approved_by_id = ?", approvedByID)
+	}
+
+	var rows []BelowStandardPriceRow
+	if err := query.Select(`
+			v.consultant_id as consultant_id,
+			COALESCE(MAX(ce.name), '') as consultant_name,
+			vi.approved_by_id as approved_by_id,
+			COALESCE(MAX(ae.name), '') as approved_by_name,
+			COUNT(*) as item_count,
+			COALESCE(SUM(vi.list_price), 0) as list_amount,
+			COALESCE(SUM(vi.amount), 0) as amount,
+			COALESCE(SUM(vi.list_price - vi.amount), 0) as discount_amount,
+			COALESCE(SUM(CASE WHEN vi.discount_type = 'coupon' THEN 1 ELSE 0 END), 0) as coupon_count`).
+		Group("v.consultant_id, vi.approved_by_id").
+		Order("discount_amount DESC").
+		Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+
+	var totalDiscount models.Money
+	var totalCount int64
+	for _, r := range rows {
+		totalDiscount += r.DiscountAmount
+		totalCount += r.ItemCount
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "success",
 		"data": gin.H{
-			"employee_id": employeeID,
-			"date_from":   dateFrom,
-			"date_to":     dateTo,
+			"date_from":      dateFrom,
+			"date_to":        dateTo,
+			"item_count":     totalCount,
+			"total_discount": totalDiscount,
+			"rows":           rows,
 		},
 	})
 }
 
-// GetProjectPerformance 获取项目业绩
-func GetProjectPerformance(c *gin.Context) {
+// AcquisitionReportRow 获客报表行：某渠道或某介绍人带来的新客及其消费
+type AcquisitionReportRow struct {
+	SourceID         *uint        `json:"source_id"`
+	SourceName       string       `json:"source_name"`
+	NewCustomers     int64        `json:"new_customers"`
+	FirstVisitAmount models.Money `json:"first_visit_amount"`
+	Amount90d        models.Money `json:"amount_90d"`
+}
+
+// GetAcquisitionReport 获客报表，按来源渠道（group_by=channel，默认）或介绍人（group_by=referrer）汇总
+// 新客为初诊日期在期间内的顾客；首诊金额为初诊单据金额，90天金额为初诊日起90天内（含初诊）已确认单据金额
+func GetAcquisitionReport(c *gin.Context) {
+	dateFrom := c.Query("date_from")
+	dateTo := c.Query("date_to")
+	if dateFrom == "" {
+		dateFrom = time.Now().In(config.ClinicLocation()).AddDate(0, -1, 0).Format("2006-01-02")
+	}
+	if dateTo == "" {
+		dateTo = time.Now().In(config.ClinicLocation()).Format("2006-01-02")
+	}
+
+	// 先按顾客汇总首诊和90天金额，再按渠道或介绍人汇总
+	newCustomersSQL := `
+		SELECT c.id, c.channel_id, c.referrer_id,
+			COALESCE(SUM(CASE WHEN v.customer_type = @new_type THEN v.total_amount ELSE 0 END), 0) as first_visit_amount,
+			COALESCE(SUM(CASE WHEN v.visit_date < DATE_ADD(c.first_visit_date, INTERVAL 90 DAY) THEN v.total_amount ELSE 0 END), 0) as amount_90d
+		FROM customers c
+		LEFT JOIN visits v ON v.customer_id = c.id AND v.deleted_at IS NULL AND v.status = @status
+		WHERE c.deleted_at IS NULL AND c.first_visit_date >= @from AND c.first_visit_date <= @to
+		GROUP BY c.id, c.channel_id, c.referrer_id`
+
+	groupBy := c.DefaultQuery("group_by", "channel")
+	var sql string
+	switch groupBy {
+	case "channel":
+		sql = `
+			SELECT n.channel_id as source_id, COALESCE(MAX(ch.name), '未填写') as source_name,
+				COUNT(*) as new_customers,
+				COALESCE(SUM(n.first_visit_amount), 0) as first_visit_amount,
+				COALESCE(SUM(n.amount_90d), 0) as amount_90d
+			FROM (` + newCustomersSQL + `) n
+			LEFT JOIN channels ch ON ch.id = n.channel_id
+			GROUP BY n.channel_id
+			ORDER BY new_customers DESC, amount_90d DESC`
+	case "referrer":
+		sql = `
+			SELECT n.referrer_id as source_id, COALESCE(MAX(r.name), '') as source_name,
+				COUNT(*) as new_customers,
+				COALESCE(SUM(n.first_visit_amount), 0) as first_visit_amount,
+				COALESCE(SUM(n.amount_90d), 0) as amount_90d
+			FROM (` + newCustomersSQL + `) n
+			JOIN customers r ON r.id = n.referrer_id
+			GROUP BY n.referrer_id
+			ORDER BY new_customers DESC, amount_90d DESC`
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的汇总方式"})
+		return
+	}
+
+	var rows []AcquisitionReportRow
+	if err := config.GetDB().Raw(sql, map[string]interface{}{
+		"new_type": models.CustomerTypeNew,
+		"status":   models.VisitStatusConfirmed,
+		"from":     dateFrom,
+		"to":       dateTo,
+	}).Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+
+	var totalCustomers int64
+	var totalFirstVisit, total90d models.Money
+	for _, r := range rows {
+		totalCustomers += r.NewCustomers
+		totalFirstVisit += r.FirstVisitAmount
+		total90d += r.Amount90d
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "success",
-		"data":    gin.H{},
+		"data": gin.H{
+			"date_from":          dateFrom,
+			"date_to":            dateTo,
+			"group_by":           groupBy,
+			"new_customers":      totalCustomers,
+			"first_visit_amount": totalFirstVisit,
+			"amount_90d":         total90d,
+			"rows":               rows,
+		},
 	})
 }
@@ -0,0 +1,402 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"skin-performance/config"
+	"skin-performance/models"
+)
+
+// CustomerRFM 顾客的 RFM 指标、评分及所属分群
+// 只统计已确认的单据；消费金额为单据金额减去退款
+type CustomerRFM struct {
+	CustomerID     uint         `json:"customer_id"`
+	Name           string       `json:"name"`
+	Phone          models.Phone `json:"phone"`
+	CustomerType   *string      `json:"customer_type,omitempty"`
+	LastVisitDate  time.Time    `json:"last_visit_date"`
+	RecencyDays    int          `json:"recency_days"`
+	Frequency      int          `json:"frequency"`
+	Monetary       models.Money `json:"monetary"`
+	RecencyScore   int          `json:"recency_score"`
+	FrequencyScore int          `json:"frequency_score"`
+	MonetaryScore  int          `json:"monetary_score"`
+	RFMScore       string       `json:"rfm_score"`
+	SegmentCode    string       `json:"segment_code"`
+	SegmentName    string       `json:"segment_name"`
+}
+
+// customerRFMQuery 截至 asOf 当天有消费记录顾客的 RFM 指标及所属分群，作为子查询 r 供筛选、排序和分页
+// 指标和分群均在数据库中计算，分群按优先级依次匹配（与 RFMSegment.Matches 一致）
+func customerRFMQuery(db *gorm.DB, asOf time.Time, segments []models.RFMSegment) *gorm.DB {
+	day := asOf.Format("2006-01-02")
+	end := day + " 23:59:59"
+
+	refunds := db.Table("refunds").
+		Joins("JOIN visit_items ON visit_items.id = refunds.visit_item_id AND visit_items.deleted_at IS NULL").
+		Joins("JOIN visits ON visits.id = visit_items.visit_id AND visits.deleted_at IS NULL").
+		Where("refunds.deleted_at IS NULL AND visits.status = ? AND refunds.refund_date <= ?", models.VisitStatusConfirmed, end).
+		Select("visits.customer_id as customer_id, COALESCE(SUM(refunds.amount), 0) as amount").
+		Group("visits.customer_id")
+
+	metrics := db.Table("customers c").
+		Joins("JOIN visits v ON v.customer_id = c.id AND v.deleted_at IS NULL").
+		Joins("LEFT JOIN (?) rf ON rf.customer_id = c.id", refunds).
+		Where("c.deleted_at IS NULL AND v.status = ? AND v.visit_date <= ?", models.VisitStatusConfirmed, end).
+		Select("c.id as customer_id, c.name as name, c.phone as phone, c.customer_type as customer_type, "+
+			"MAX(v.visit_date) as last_visit_date, DATEDIFF(?, MAX(v.visit_date)) as recency_days, COUNT(v.id) as frequency, "+
+			"COALESCE(SUM(v.total_amount), 0) - COALESCE(MAX(rf.amount), 0) as monetary", day).
+		Group("c.id, c.name, c.phone, c.customer_type")
+
+	segmentSQL := "''"
+	var args []interface{}
+	if len(segments) > 0 {
+		segmentSQL = "CASE"
+		for i := range segments {
+			cond, condArgs := rfmSegmentCondition(&segments[i])
+			segmentSQL += " WHEN " + cond + " THEN ?"
+			args = append(args, condArgs...)
+			args = append(args, segments[i].Code)
+		}
+		segmentSQL += " ELSE '' END"
+	}
+	scored := db.Table("(?) m", metrics).Select("m.*, "+segmentSQL+" as segment_code", args...)
+	return db.Table("(?) r", scored)
+}
+
+// rfmSegmentCondition 分群区间对应的 SQL 条件，条件为空时匹配所有顾客
+func rfmSegmentCondition(s *models.RFMSegment) (string, []interface{}) {
+	cond := "1 = 1"
+	var args []interface{}
+	add := func(expr string, v interface{}) {
+		cond += " AND " + expr
+		args = append(args, v)
+	}
+	if s.RecencyDaysMin != nil {
+		add("m.recency_days >= ?", *s.RecencyDaysMin)
+	}
+	if s.RecencyDaysMax != nil {
+		add("m.recency_days <= ?", *s.RecencyDaysMax)
+	}
+	if s.FrequencyMin != nil {
+		add("m.frequency >= ?", *s.FrequencyMin)
+	}
+	if s.FrequencyMax != nil {
+		add("m.frequency <= ?", *s.FrequencyMax)
+	}
+	if s.MonetaryMin != nil {
+		add("m.monetary >= ?", *s.MonetaryMin)
+	}
+	if s.MonetaryMax != nil {
+		add("m.monetary <= ?", *s.MonetaryMax)
+	}
+	return "(" + cond + ")", args
+}
+
+// scoreCustomerRFM 为查询结果计算 R/F/M 得分并填入分群名称
+func scoreCustomerRFM(rows []CustomerRFM, segments []models.RFMSegment) {
+	names := make(map[string]string, len(segments))
+	for _, seg := range segments {
+		names[seg.Code] = seg.Name
+	}
+	for i := range rows {
+		r := &rows[i]
+		r.RecencyScore = models.RecencyScore(r.RecencyDays)
+		r.FrequencyScore = models.FrequencyScore(r.Frequency)
+		r.MonetaryScore = models.MonetaryScore(r.Monetary)
+		r.RFMScore = strconv.Itoa(r.RecencyScore) + strconv.Itoa(r.FrequencyScore) + strconv.Itoa(r.MonetaryScore)
+		r.SegmentName = names[r.SegmentCode]
+	}
+}
+
+// ListCustomerRFM 顾客 RFM 分群列表，用于护士回访
+// 可按 segment（分群代码）、recency_days_min、monetary_min 筛选，as_of 指定统计日期（默认今天）；
+// 默认按消费金额从高到低排序，sort=recency 时按最近就诊由远到近排序；format=csv 时导出全部筛选结果
+// 指标、分群、筛选和分页均在数据库中完成，只为当前页计算得分
+func ListCustomerRFM(c *gin.Context) {
+	asOf := time.Now().In(config.ClinicLocation())
+	if s := c.Query("as_of"); s != "" {
+		t, err := time.ParseInLocation("2006-01-02", s, config.ClinicLocation())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的统计日期"})
+			return
+		}
+		asOf = t
+	}
+
+	db := config.GetDB()
+	var segments []models.RFMSegment
+	if err := db.Where("is_active = ?", true).Order("priority DESC, id").Find(&segments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+
+	query := customerRFMQuery(db, asOf, segments)
+	if segment := c.Query("segment"); segment != "" {
+		query = query.Where("r.segment_code = ?", segment)
+	}
+	if s := c.Query("recency_days_min"); s != "" {
+		recencyMin, err := strconv.Atoi(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的未就诊天数"})
+			return
+		}
+		query = query.Where("r.recency_days >= ?", recencyMin)
+	}
+	if s := c.Query("monetary_min"); s != "" {
+		monetaryMin, err := models.ParseMoney(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的消费金额"})
+			return
+		}
+		query = query.Where("r.monetary >= ?", monetaryMin)
+	}
+
+	order := "r.monetary DESC, r.customer_id"
+	if c.Query("sort") == "recency" {
+		order = "r.recency_days DESC, r.customer_id"
+	}
+
+	if c.Query("format") == "csv" {
+		var rows []CustomerRFM
+		if err := query.Order(order).Scan(&rows).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+			return
+		}
+		scoreCustomerRFM(rows, segments)
+		writeCustomerRFMCSV(c, rows, asOf)
+		return
+	}
+
+	// 分页
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+	rows := []CustomerRFM{}
+	if err := query.Order(order).Limit(pageSize).Offset((page - 1) * pageSize).Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+	scoreCustomerRFM(rows, segments)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"as_of":     asOf.Format("2006-01-02"),
+			"list":      rows,
+			"total":     total,
+			"page":      page,
+			"page_size": pageSize,
+		},
+	})
+}
+
+// writeCustomerRFMCSV 导出 RFM 列表为 CSV，带 BOM 以便 Excel 正确识别中文
+// 有查看联系方式权限时导出完整电话，每位顾客记录一条访问日志；否则导出脱敏电话
+func writeCustomerRFMCSV(c *gin.Context, rows []CustomerRFM, asOf time.Time) {
+	showPhone := false
+	if canViewContact(c) {
+		ids := make([]uint, len(rows))
+		for i, r := range rows {
+			ids[i] = r.CustomerID
+		}
+		showPhone = logContactAccess(c, models.ContactSubjectCustomer, contactActionExport, ids) == nil
+	}
+
+	filename := "customer-rfm-" + asOf.Format("20060102") + ".csv"
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.Status(http.StatusOK)
+	c.Writer.Write([]byte("\xEF\xBB\xBF"))
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"顾客ID", "姓名", "电话", "顾客类型", "最近就诊", "未就诊天数", "就诊次数", "消费金额", "R", "F", "M", "RFM", "分群"})
+	for _, r := range rows {
+		customerType := ""
+		if r.CustomerType != nil {
+			customerType = *r.CustomerType
+		}
+		phone := r.Phone.Masked()
+		if showPhone {
+			phone = string(r.Phone)
+		}
+		w.Write([]string{
+			strconv.FormatUint(uint64(r.CustomerID), 10),
+			r.Name,
+			phone,
+			customerType,
+			r.LastVisitDate.Format("2006-01-02"),
+			strconv.Itoa(r.RecencyDays),
+			strconv.Itoa(r.Frequency),
+			r.Monetary.String(),
+			strconv.Itoa(r.RecencyScore),
+			strconv.Itoa(r.FrequencyScore),
+			strconv.Itoa(r.MonetaryScore),
+			r.RFMScore,
+			r.SegmentName,
+		})
+	}
+	w.Flush()
+}
+
+// ListRFMSegments 获取顾客分群定义
+func ListRFMSegments(c *gin.Context) {
+	var segments []models.RFMSegment
+	if err := config.GetDB().Order("priority DESC, id").Find(&segments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    segments,
+	})
+}
+
+// CreateRFMSegment 创建顾客分群定义
+func CreateRFMSegment(c *gin.Context) {
+	var segment models.RFMSegment
+	if err := c.ShouldBindJSON(&segment); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误"})
+		return
+	}
+	if msg := validateRFMSegment(config.GetDB(), &segment); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": msg})
+		return
+	}
+
+	now := time.Now()
+	segment.CreatedAt = &now
+	segment.UpdatedAt = &now
+	segment.IsActive = true
+
+	if err := config.GetDB().Create(&segment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "创建成功",
+		"data":    segment,
+	})
+}
+
+// RFMSegmentUpdateRequest 更新分群请求，未提交 is_active 时保持原启用状态
+type RFMSegmentUpdateRequest struct {
+	models.RFMSegment
+	IsActive *bool `json:"is_active"`
+}
+
+// UpdateRFMSegment 更新顾客分群定义，区间条件整体替换（未提交的条件视为不限）
+func UpdateRFMSegment(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	var segment models.RFMSegment
+	if err := config.GetDB().First(&segment, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "分群不存在"})
+		return
+	}
+
+	var req RFMSegmentUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误"})
+		return
+	}
+	input := req.RFMSegment
+	input.ID = segment.ID
+	input.IsActive = segment.IsActive
+	if req.IsActive != nil {
+		input.IsActive = *req.IsActive
+	}
+	if input.Code == "" {
+		input.Code = segment.Code
+	}
+	if input.Name == "" {
+		input.Name = segment.Name
+	}
+	if msg := validateRFMSegment(config.GetDB(), &input); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": msg})
+		return
+	}
+
+	now := time.Now()
+	input.UpdatedAt = &now
+
+	if err := config.GetDB().Model(&segment).Select(
+		"code", "name", "recency_days_min", "recency_days_max", "frequency_min", "frequency_max",
+		"monetary_min", "monetary_max", "priority", "description", "is_active", "updated_at",
+	).Updates(&input).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "更新成功",
+		"data":    segment,
+	})
+}
+
+// DeleteRFMSegment 删除顾客分群定义（软删除）
+func DeleteRFMSegment(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	if err := config.GetDB().Delete(&models.RFMSegment{}, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "删除失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "删除成功",
+	})
+}
+
+// validateRFMSegment 校验分群定义，返回错误信息
+func validateRFMSegment(db *gorm.DB, segment *models.RFMSegment) string {
+	if segment.Code == "" || segment.Name == "" {
+		return "分群代码和名称为必填项"
+	}
+	var count int64
+	db.Model(&models.RFMSegment{}).Where("code = ? AND id <> ?", segment.Code, segment.ID).Count(&count)
+	if count > 0 {
+		return "分群代码已存在"
+	}
+	if segment.RecencyDaysMin != nil && segment.RecencyDaysMax != nil && *segment.RecencyDaysMin > *segment.RecencyDaysMax {
+		return "未就诊天数下限不能大于上限"
+	}
+	if segment.FrequencyMin != nil && segment.FrequencyMax != nil && *segment.FrequencyMin > *segment.FrequencyMax {
+		return "就诊次数下限不能大于上限"
+	}
+	if segment.MonetaryMin != nil && segment.MonetaryMax != nil && *segment.MonetaryMin > *segment.MonetaryMax {
+		return "消费金额下限不能大于上限"
+	}
+	return ""
+}
@@ -0,0 +1,359 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"skin-performance/config"
+	"skin-performance/models"
+	"skin-performance/reports"
+)
+
+// tierBracket 阶梯提成单档计算结果
+type tierBracket struct {
+	LowerBound models.Money  `json:"lower_bound"`
+	UpperBound *models.Money `json:"upper_bound,omitempty"`
+	Rate       float64       `json:"rate"`
+	Amount     models.Money  `json:"amount"`
+	Commission models.Money  `json:"commission"`
+}
+
+// SettlementResult 员工月度结算计算结果
+type SettlementResult struct {
+	EmployeeID       uint          `json:"employee_id"`
+	EmployeeName     string        `json:"employee_name"`
+	EmployeeRole     string        `json:"employee_role"`
+	Month            string        `json:"month"`
+	BaseAmount       models.Money  `json:"base_amount"`
+	Commission       models.Money  `json:"commission"`
+	EffectiveRate    float64       `json:"effective_rate"`
+	CommissionPlanID *uint         `json:"commission_plan_id,omitempty"`
+	Brackets         []tierBracket `json:"brackets"`
+}
+
+// applyCommissionTiers 按阶梯档位累进计算提成
+// 每个档位只对落在本档区间内的部分按本档比例计提
+// 各档提成分别四舍五入到分，合计为各档之和
+func applyCommissionTiers(base models.Money, tiers []models.CommissionTier) (models.Money, []tierBracket) {
+	sorted := make([]models.CommissionTier, len(tiers))
+	copy(sorted, tiers)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].LowerBound < sorted[j].LowerBound })
+
+	var commission models.Money
+	brackets := []tierBracket{}
+	for _, tier := range sorted {
+		if base <= tier.LowerBound {
+			break
+		}
+		upper := base
+		if tier.UpperBound != nil && *tier.UpperBound < base {
+			upper = *tier.UpperBound
+		}
+		amount := upper - tier.LowerBound
+		if amount <= 0 {
+			continue
+		}
+		bracket := tierBracket{
+			LowerBound: tier.LowerBound,
+			UpperBound: tier.UpperBound,
+			Rate:       tier.Rate,
+			Amount:     amount,
+			Commission: amount.MulRatio(tier.Rate),
+		}
+		commission += bracket.Commission
+		brackets = append(brackets, bracket)
+	}
+	return commission, brackets
+}
+
+// parseSettlementMonth 解析结算月份（YYYY-MM），返回当月首日和末日
+func parseSettlementMonth(month string) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation("2006-01", month, config.ClinicLocation())
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return start, start.AddDate(0, 1, -1), nil
+}
+
+// monthSettled 时间所在月份是否已有结算记录，已结算月份的业绩不能再变动
+func monthSettled(db *gorm.DB, t time.Time) (bool, error) {
+	var count int64
+	err := db.Model(&models.PerformanceSettlement{}).Where("month = ?", t.Format("2006-01")).Count(&count).Error
+	return count > 0, err
+}
+
+// errVisitMonthSettled 就诊日期所在月份已结算，单据状态不能再变更
+var errVisitMonthSettled = errors.New("就诊日期所在月份已结算，不能变更单据状态")
+
+// ensureVisitMonthOpen 在事务中检查就诊日期所在月份未结算，已结算时返回 errVisitMonthSettled
+func ensureVisitMonthOpen(tx *gorm.DB, visitID uint64) error {
+	var visit models.Visit
+	if err := tx.Select("id", "visit_date").First(&visit, visitID).Error; err != nil {
+		return err
+	}
+	settled, err := monthSettled(tx, visit.VisitDate)
+	if err != nil {
+		return err
+	}
+	if settled {
+		return errVisitMonthSettled
+	}
+	return nil
+}
+
+// allocatedPerformanceByEmployee 汇总日期范围内各员工的净业绩（已确认单据的分配业绩扣除期间内的退款冲减）
+func allocatedPerformanceByEmployee(db *gorm.DB, dateFrom, dateTo string) (map[uint]models.Money, error) {
+	type row struct {
+		EmployeeID uint
+		Amount     models.Money
+	}
+	var rows []row
+	sql := `
+		SELECT p.employee_id, COALESCE(SUM(p.performance), 0) as amount
+		FROM (` + reports.PerformanceEntriesSQL + `) p
+		WHERE p.biz_date >= @from AND p.biz_date <= @to
+		GROUP BY p.employee_id
+	`
+	if err := db.Raw(sql, reports.EntriesParams(dateFrom, dateTo)).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	amounts := make(map[uint]models.Money, len(rows))
+	for _, r := range rows {
+		amounts[r.EmployeeID] = r.Amount
+	}
+	return amounts, nil
+}
+
+// computeSettlements 计算月度阶梯提成结算
+// 使用月末有效的提成方案中的阶梯档位；employeeID 为 0 时计算所有配置了档位的角色的员工
+func computeSettlements(db *gorm.DB, month string, employeeID uint) ([]SettlementResult, error) {
+	start, end, err := parseSettlementMonth(month)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := findCommissionPlan(db, end)
+	if err != nil {
+		return nil, err
+	}
+
+	var tiers []models.CommissionTier
+	query := db.Where("is_active = ?", true)
+	if plan != nil {
+		query = query.Where("plan_id = ?", plan.ID)
+	} else {
+		query = query.Where("plan_id IS NULL")
+	}
+	if err := query.Find(&tiers).Error; err != nil {
+		return nil, err
+	}
+	tiersByRole := make(map[string][]models.CommissionTier)
+	for _, tier := range tiers {
+		tiersByRole[tier.Role] = append(tiersByRole[tier.Role], tier)
+	}
+
+	amounts, err := allocatedPerformanceByEmployee(db, start.Format("2006-01-02"), end.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+
+	var employees []models.Employee
+	empQuery := db.Model(&models.Employee{})
+	if employeeID != 0 {
+		empQuery = empQuery.Where("id = ?", employeeID)
+	}
+	if err := empQuery.Order("id").Find(&employees).Error; err != nil {
+		return nil, err
+	}
+
+	results := []SettlementResult{}
+	for _, e := range employees {
+		roleTiers, ok := tiersByRole[e.Role]
+		if !ok && employeeID == 0 {
+			continue
+		}
+		base := amounts[e.ID]
+		if base == 0 && employeeID == 0 {
+			continue
+		}
+
+		commission, brackets := applyCommissionTiers(base, roleTiers)
+		result := SettlementResult{
+			EmployeeID:   e.ID,
+			EmployeeName: e.Name,
+			EmployeeRole: e.Role,
+			Month:        month,
+			BaseAmount:   base,
+			Commission:   commission,
+			Brackets:     brackets,
+		}
+		if base > 0 {
+			result.EffectiveRate = commission.Ratio(base)
+		}
+		if plan != nil {
+			result.CommissionPlanID = &plan.ID
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// GetSettlementReport 月度阶梯提成结算报表（实时计算，不落库）
+func GetSettlementReport(c *gin.Context) {
+	month := c.DefaultQuery("month", time.Now().In(config.ClinicLocation()).Format("2006-01"))
+	var employeeID uint64
+	if s := c.Query("employee_id"); s != "" {
+		var err error
+		if employeeID, err = strconv.ParseUint(s, 10, 32); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的员工ID"})
+			return
+		}
+	}
+
+	results, err := computeSettlements(config.GetDB(), month, uint(employeeID))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "结算计算失败: " + err.Error()})
+		return
+	}
+
+	var settled int64
+	config.GetDB().Model(&models.PerformanceSettlement{}).Where("month = ?", month).Count(&settled)
+
+	var totalCommission models.Money
+	for _, r := range results {
+		totalCommission += r.Commission
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"month":            month,
+			"settled":          settled > 0,
+			"total_commission": totalCommission,
+			"reports":          results,
+		},
+	})
+}
+
+// SettleRequest 月度结算请求
+type SettleRequest struct {
+	Month string `json:"month" binding:"required"`
+}
+
+// CreateSettlements 计算并保存月度结算记录
+// 重复结算时该月已有记录软删除保留，新记录的版本号在该月已有最大版本上递增
+func CreateSettlements(c *gin.Context) {
+	var req SettleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误"})
+		return
+	}
+
+	tx := config.GetDB().Begin()
+	results, err := computeSettlements(tx, req.Month, 0)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "结算计算失败: " + err.Error()})
+		return
+	}
+
+	var version int
+	if err := tx.Unscoped().Model(&models.PerformanceSettlement{}).Where("month = ?", req.Month).
+		Select("COALESCE(MAX(version), 0)").Scan(&version).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询旧结算失败"})
+		return
+	}
+	if err := tx.Where("month = ?", req.Month).Delete(&models.PerformanceSettlement{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "作废旧结算失败"})
+		return
+	}
+
+	now := time.Now()
+	settlements := make([]models.PerformanceSettlement, 0, len(results))
+	for _, r := range results {
+		brackets, _ := json.Marshal(r.Brackets)
+		settlements = append(settlements, models.PerformanceSettlement{
+			EmployeeID:       r.EmployeeID,
+			Month:            r.Month,
+			Version:          version + 1,
+			BaseAmount:       r.BaseAmount,
+			Commission:       r.Commission,
+			EffectiveRate:    r.EffectiveRate,
+			CommissionPlanID: r.CommissionPlanID,
+			Brackets:         string(brackets),
+			SettledAt:        now,
+			SettledBy:        currentUserID(c),
+			CreatedAt:        &now,
+			UpdatedAt:        &now,
+		})
+	}
+	if len(settlements) > 0 {
+		if err := tx.Create(&settlements).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "保存结算失败: " + err.Error()})
+			return
+		}
+	}
+	tx.Commit()
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "结算成功",
+		"data": gin.H{
+			"month": req.Month,
+			"list":  settlements,
+		},
+	})
+}
+
+// ListSettlements 获取已保存的月度结算记录
+func ListSettlements(c *gin.Context) {
+	var settlements []models.PerformanceSettlement
+	query := config.GetDB().Model(&models.PerformanceSettlement{}).Preload("Employee")
+
+	if month := c.Query("month"); month != "" {
+		query = query.Where("month = ?", month)
+	}
+	if employeeID := c.Query("employee_id"); employeeID != "" {
+		query = query.Where("employee_id = ?", employeeID)
+	}
+
+	// 分页
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	var total int64
+	query.Count(&total)
+
+	if err := query.Order("month DESC, commission DESC").Limit(pageSize).Offset((page - 1) * pageSize).Find(&settlements).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"list":      settlements,
+			"total":     total,
+			"page":      page,
+			"page_size": pageSize,
+		},
+	})
+}
@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"skin-performance/config"
+	"skin-performance/models"
+)
+
+// errInsufficientBalance 储值余额不足
+var errInsufficientBalance = errors.New("储值余额不足")
+
+// changeStoredValue 在事务中变动顾客储值余额并记录流水
+// 账户不存在时自动开户；变动前锁定账户行，余额不足时返回 errInsufficientBalance
+func changeStoredValue(tx *gorm.DB, customerID uint, entry models.StoredValueTransaction) (models.StoredValueTransaction, error) {
+	now := time.Now()
+	account := models.StoredValueAccount{CustomerID: customerID, CreatedAt: &now, UpdatedAt: &now}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&account).Error; err != nil {
+		return entry, err
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("customer_id = ?", customerID).First(&account).Error; err != nil {
+		return entry, err
+	}
+
+	balance := account.Balance + entry.Amount
+	if balance < 0 {
+		return entry, errInsufficientBalance
+	}
+	if err := tx.Model(&account).Updates(map[string]interface{}{
+		"balance":    balance,
+		"updated_at": now,
+	}).Error; err != nil {
+		return entry, err
+	}
+
+	entry.ID = 0
+	entry.AccountID = account.ID
+	entry.CustomerID = customerID
+	entry.BalanceAfter = balance
+	entry.CreatedAt = &now
+	if err := tx.Create(&entry).Error; err != nil {
+		return entry, err
+	}
+	return entry, nil
+}
+
+// GetStoredValueAccount 获取顾客储值账户，未开户时余额为0
+func GetStoredValueAccount(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	var customer models.Customer
+	if err := config.GetDB().First(&customer, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "顾客不存在"})
+		return
+	}
+
+	account := models.StoredValueAccount{CustomerID: customer.ID}
+	config.GetDB().Where("customer_id = ?", customer.ID).First(&account)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    account,
+	})
+}
+
+// StoredValueRequest 储值充值/退卡请求
+type StoredValueRequest struct {
+	Amount        models.Money `json:"amount"`
+	PaymentMethod string       `json:"payment_method"`
+	Remark        *string      `json:"remark"`
+}
+
+// changeStoredValueByRequest 按请求充值或退卡，sign 为 1 表示充值，-1 表示退卡
+func changeStoredValueByRequest(c *gin.Context, entryType string, sign models.Money, message string) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	var req StoredValueRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误"})
+		return
+	}
+	if req.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "金额必须大于0"})
+		return
+	}
+	if !models.IsPaymentMethod(req.PaymentMethod) || req.PaymentMethod == models.PaymentMethodPrepaid {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的支付方式"})
+		return
+	}
+
+	var customer models.Customer
+	if err := config.GetDB().First(&customer, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "顾客不存在"})
+		return
+	}
+
+	tx := config.GetDB().Begin()
+	entry, err := changeStoredValue(tx, customer.ID, models.StoredValueTransaction{
+		Type:          entryType,
+		Amount:        sign * req.Amount,
+		PaymentMethod: &req.PaymentMethod,
+		Remark:        req.Remark,
+		OperatorID:    currentUserID(c),
+	})
+	if errors.Is(err, errInsufficientBalance) {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新储值余额失败"})
+		return
+	}
+	tx.Commit()
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": message,
+		"data":    entry,
+	})
+}
+
+// TopUpStoredValue 储值充值
+func TopUpStoredValue(c *gin.Context) {
+	changeStoredValueByRequest(c, models.StoredValueTopUp, 1, "充值成功")
+}
+
+// RefundStoredValue 储值退卡，将余额按指定方式退还顾客
+func RefundStoredValue(c *gin.Context) {
+	changeStoredValueByRequest(c, models.StoredValueRefund, -1, "退款成功")
+}
+
+// ListStoredValueTransactions 获取顾客储值流水
+func ListStoredValueTransactions(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	var entries []models.StoredValueTransaction
+	query := config.GetDB().Model(&models.StoredValueTransaction{}).Where("customer_id = ?", id)
+
+	if entryType := c.Query("type"); entryType != "" {
+		query = query.Where("type = ?", entryType)
+	}
+	if dateFrom := c.Query("date_from"); dateFrom != "" {
+		query = query.Where("created_at >= ?", dateFrom)
+	}
+	if dateTo := c.Query("date_to"); dateTo != "" {
+		query = query.Where("created_at <= ?", dateTo+" 23:59:59")
+	}
+
+	// 分页
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	var total int64
+	query.Count(&total)
+
+	if err := query.Order("id DESC").Limit(pageSize).Offset((page - 1) * pageSize).Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"list":      entries,
+			"total":     total,
+			"page":      page,
+			"page_size": pageSize,
+		},
+	})
+}
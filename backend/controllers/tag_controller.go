@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"skin-performance/config"
+	"skin-performance/models"
+)
+
+// TagWithCount 标签及使用该标签的顾客数
+type TagWithCount struct {
+	models.Tag
+	CustomerCount int64 `json:"customer_count"`
+}
+
+// ListTags 获取标签列表，附带每个标签的顾客数
+func ListTags(c *gin.Context) {
+	var tags []TagWithCount
+	if err := config.GetDB().Table("tags").
+		Select(`tags.*, (SELECT COUNT(*) FROM customer_tags ct
+			JOIN customers cu ON cu.id = ct.customer_id AND cu.deleted_at IS NULL
+			WHERE ct.tag_id = tags.id) AS customer_count`).
+		Order("tags.name").Scan(&tags).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    tags,
+	})
+}
+
+// CreateTag 创建标签
+func CreateTag(c *gin.Context) {
+	var tag models.Tag
+	if err := c.ShouldBindJSON(&tag); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误"})
+		return
+	}
+	if msg := validateTag(config.GetDB(), &tag); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": msg})
+		return
+	}
+
+	now := time.Now()
+	tag.CreatedAt = &now
+	tag.UpdatedAt = &now
+
+	if err := config.GetDB().Create(&tag).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "创建成功",
+		"data":    tag,
+	})
+}
+
+// UpdateTag 更新标签，保存的顾客分组按标签ID筛选，改名不影响分组
+func UpdateTag(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	var tag models.Tag
+	if err := config.GetDB().First(&tag, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "标签不存在"})
+		return
+	}
+
+	var input models.Tag
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误"})
+		return
+	}
+	input.ID = tag.ID
+	if msg := validateTag(config.GetDB(), &input); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": msg})
+		return
+	}
+
+	updates := map[string]interface{}{
+		"name":       input.Name,
+		"color":      input.Color,
+		"updated_at": time.Now(),
+	}
+	if err := config.GetDB().Model(&tag).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "更新成功",
+		"data":    tag,
+	})
+}
+
+// DeleteTag 删除标签，同时解除与顾客的关联；引用该标签的顾客分组不再匹配该标签
+func DeleteTag(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	err = config.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM customer_tags WHERE tag_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Tag{}, id).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "删除失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "删除成功",
+	})
+}
+
+// CustomerTagsRequest 设置顾客标签请求
+type CustomerTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// SetCustomerTags 设置顾客标签（整体替换），不存在的标签自动创建
+func SetCustomerTags(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	var req CustomerTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误"})
+		return
+	}
+	names := splitList(strings.Join(req.Tags, ","))
+	for _, name := range names {
+		if utf8.RuneCountInString(name) > 32 {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "标签名称不能超过32个字"})
+			return
+		}
+	}
+
+	var customer models.Customer
+	if err := config.GetDB().First(&customer, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "顾客不存在"})
+		return
+	}
+
+	tx := config.GetDB().Begin()
+	tags := make([]models.Tag, 0, len(names))
+	for _, name := range names {
+		var tag models.Tag
+		if err := tx.Where("name = ?", name).Limit(1).Find(&tag).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询标签失败"})
+			return
+		}
+		if tag.ID == 0 {
+			now := time.Now()
+			tag = models.Tag{Name: name, CreatedAt: &now, UpdatedAt: &now}
+			if err := tx.Create(&tag).Error; err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建标签失败"})
+				return
+			}
+		}
+		tags = append(tags, tag)
+	}
+	if err := tx.Model(&customer).Association("Tags").Replace(tags); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "设置标签失败"})
+		return
+	}
+	tx.Commit()
+
+	customer.Tags = tags
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "设置成功",
+		"data":    customer,
+	})
+}
+
+// validateTag 校验标签，返回错误信息
+func validateTag(db *gorm.DB, tag *models.Tag) string {
+	tag.Name = strings.TrimSpace(tag.Name)
+	if tag.Name == "" {
+		return "标签名称为必填项"
+	}
+	if strings.Contains(tag.Name, ",") {
+		return "标签名称不能包含逗号"
+	}
+	if utf8.RuneCountInString(tag.Name) > 32 {
+		return "标签名称不能超过32个字"
+	}
+	var count int64
+	db.Model(&models.Tag{}).Where("name = ? AND id <> ?", tag.Name, tag.ID).Count(&count)
+	if count > 0 {
+		return "标签名称已存在"
+	}
+	return ""
+}
@@ -0,0 +1,252 @@
+package controllers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"skin-performance/config"
+	"skin-performance/models"
+	"skin-performance/reports"
+)
+
+// Timeseries granularity constants
+const (
+	granularityDay   = "day"
+	granularityWeek  = "week"
+	granularityMonth = "month"
+)
+
+// Timeseries metric constants
+const (
+	timeseriesMetricRevenue     = "revenue"     // 成交金额（扣除退款）
+	timeseriesMetricPerformance = "performance" // 业绩（扣除退款冲减）
+)
+
+// maxTimeseriesBuckets 单次查询允许的最大时间桶数
+const maxTimeseriesBuckets = 400
+
+// unassignedConsultant 未指定咨询师的单据归入的分组名
+const unassignedConsultant = "未指定咨询师"
+
+// TimeseriesSeries 某个分组在各时间桶上的值，Values 与响应中的 buckets 一一对应
+type TimeseriesSeries struct {
+	ID     *uint          `json:"id"`
+	Name   string         `json:"name"`
+	Values []models.Money `json:"values"`
+	Total  models.Money   `json:"total"`
+}
+
+// bucketStart 日期在时区 loc 中所在时间桶的起始日期：周以周一开始，月以1日开始
+func bucketStart(t time.Time, granularity string, loc *time.Location) time.Time {
+	t = t.In(loc)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	switch granularity {
+	case granularityWeek:
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case granularityMonth:
+		return day.AddDate(0, 0, 1-day.Day())
+	}
+	return day
+}
+
+// nextBucket 下一个时间桶的起始日期
+func nextBucket(start time.Time, granularity string) time.Time {
+	switch granularity {
+	case granularityWeek:
+		return start.AddDate(0, 0, 7)
+	case granularityMonth:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// GetTimeseriesReport 按天/周/月汇总的成交金额或业绩趋势，没有数据的时间桶补0
+// 成交金额按就诊日期、退款按退款日期计入；业绩取明细分配记录中保存的结果。
+// group_by 可按员工（仅业绩）、项目、项目分类或单据的咨询师拆分为多条序列
+func GetTimeseriesReport(c *gin.Context) {
+	loc := config.ClinicLocation()
+	dateFrom := c.Query("date_from")
+	dateTo := c.Query("date_to")
+	if dateFrom == "" {
+		dateFrom = time.Now().In(loc).AddDate(0, -1, 0).Format("2006-01-02")
+	}
+	if dateTo == "" {
+		dateTo = time.Now().In(loc).Format("2006-01-02")
+	}
+	from, err := time.ParseInLocation("2006-01-02", dateFrom, loc)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "开始日期格式错误"})
+		return
+	}
+	to, err := time.ParseInLocation("2006-01-02", dateTo, loc)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "结束日期格式错误"})
+		return
+	}
+	if to.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "结束日期不能早于开始日期"})
+		return
+	}
+
+	granularity := c.DefaultQuery("granularity", granularityDay)
+	if granularity != granularityDay && granularity != granularityWeek && granularity != granularityMonth {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的时间粒度"})
+		return
+	}
+	metric := c.DefaultQuery("metric", timeseriesMetricRevenue)
+	if metric != timeseriesMetricRevenue && metric != timeseriesMetricPerformance {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的统计指标"})
+		return
+	}
+
+	// 分组字段：group_id 为员工/项目/咨询师ID，group_key 为项目分类
+	groupBy := c.Query("group_by")
+	var groupSelect string
+	switch groupBy {
+	case "":
+		groupSelect = "NULL AS group_id, '' AS group_key"
+	case "employee":
+		if metric != timeseriesMetricPerformance {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "按员工分组仅支持业绩指标"})
+			return
+		}
+		groupSelect = "en.employee_id AS group_id, '' AS group_key"
+	case "project":
+		groupSelect = "vi.project_id AS group_id, '' AS group_key"
+	case "category":
+		groupSelect = "NULL AS group_id, COALESCE(pr.category, '') AS group_key"
+	case "consultant":
+		groupSelect = "v.consultant_id AS group_id, '' AS group_key"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的分组方式"})
+		return
+	}
+
+	// 生成时间桶，首尾桶可能只包含部分日期
+	var buckets []string
+	index := make(map[string]int)
+	for start := bucketStart(from, granularity, loc); !start.After(to); start = nextBucket(start, granularity) {
+		if len(buckets) >= maxTimeseriesBuckets {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "时间范围过大，请缩小范围或使用更粗的时间粒度"})
+			return
+		}
+		label := start.Format("2006-01-02")
+		index[label] = len(buckets)
+		buckets = append(buckets, label)
+	}
+
+	source, value := reports.RevenueEntriesSQL, "en.amount"
+	if metric == timeseriesMetricPerformance {
+		source, value = reports.PerformanceEntriesSQL, "en.performance"
+	}
+	// 数据库中的时间为诊所时区的时间，先按天汇总，再在内存中合并为周/月
+	sql := `
+		SELECT DATE_FORMAT(en.biz_date, '%Y-%m-%d') AS day, ` + groupSelect + `,
+			COALESCE(SUM(` + value + `), 0) AS value
+		FROM (` + source + `) en
+		JOIN visit_items vi ON vi.id = en.visit_item_id
+		JOIN visits v ON v.id = vi.visit_id
+		LEFT JOIN projects pr ON pr.id = vi.project_id
+		WHERE en.biz_date >= @from AND en.biz_date <= @to
+		GROUP BY day, group_id, group_key
+	`
+	var rows []struct {
+		Day      string
+		GroupID  *uint
+		GroupKey string
+		Value    models.Money
+	}
+	db := config.GetDB()
+	if err := db.Raw(sql, reports.EntriesParams(dateFrom, dateTo)).Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+
+	total := make([]models.Money, len(buckets))
+	seriesByKey := make(map[string]*TimeseriesSeries)
+	var ids []uint
+	for _, r := range rows {
+		day, err := time.ParseInLocation("2006-01-02", r.Day, loc)
+		if err != nil {
+			continue
+		}
+		i, ok := index[bucketStart(day, granularity, loc).Format("2006-01-02")]
+		if !ok {
+			continue
+		}
+		total[i] += r.Value
+		if groupBy == "" {
+			continue
+		}
+
+		key := r.GroupKey
+		if r.GroupID != nil {
+			key = strconv.FormatUint(uint64(*r.GroupID), 10)
+		}
+		s := seriesByKey[key]
+		if s == nil {
+			s = &TimeseriesSeries{ID: r.GroupID, Name: r.GroupKey, Values: make([]models.Money, len(buckets))}
+			seriesByKey[key] = s
+			if r.GroupID != nil {
+				ids = append(ids, *r.GroupID)
+			}
+		}
+		s.Values[i] += r.Value
+		s.Total += r.Value
+	}
+
+	// 分组名称（含已停用或已删除的员工和项目）
+	names := make(map[uint]string)
+	if len(ids) > 0 {
+		switch groupBy {
+		case "project":
+			var projects []models.Project
+			db.Unscoped().Select("id", "name").Where("id IN ?", ids).Find(&projects)
+			for _, p := range projects {
+				names[p.ID] = p.Name
+			}
+		case "employee", "consultant":
+			var employees []models.Employee
+			db.Unscoped().Select("id", "name").Where("id IN ?", ids).Find(&employees)
+			for _, e := range employees {
+				names[e.ID] = e.Name
+			}
+		}
+	}
+	series := make([]TimeseriesSeries, 0, len(seriesByKey))
+	for _, s := range seriesByKey {
+		switch {
+		case s.ID != nil:
+			s.Name = names[*s.ID]
+		case groupBy == "category" && s.Name == "":
+			s.Name = uncategorizedProject
+		case groupBy == "consultant":
+			s.Name = unassignedConsultant
+		}
+		series = append(series, *s)
+	}
+	sort.Slice(series, func(i, j int) bool {
+		if series[i].Total != series[j].Total {
+			return series[i].Total > series[j].Total
+		}
+		return series[i].Name < series[j].Name
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"date_from":   dateFrom,
+			"date_to":     dateTo,
+			"granularity": granularity,
+			"metric":      metric,
+			"group_by":    groupBy,
+			"buckets":     buckets,
+			"total":       total,
+			"series":      series,
+		},
+	})
+}
@@ -1,11 +1,14 @@
 package controllers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 	"skin-performance/config"
 	"skin-performance/models"
 )
@@ -29,6 +32,15 @@ func ListVisits(c *gin.Context) {
 	if visitID := c.Query("visit_id"); visitID != "" {
 		query = query.Where("visit_id LIKE ?", "%"+visitID+"%")
 	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if customerType := c.Query("customer_type"); customerType != "" {
+		query = query.Where("customer_type = ?", customerType)
+	}
+	if paymentStatus := c.Query("payment_status"); paymentStatus != "" {
+		query = query.Where("payment_status = ?", paymentStatus)
+	}
 	if dateFrom := c.Query("date_from"); dateFrom != "" {
 		query = query.Where("visit_date >= ?", dateFrom)
 	}
@@ -74,11 +86,8 @@ func GetVisit(c *gin.Context) {
 		return
 	}
 
-	var visit models.Visit
-	if err := config.GetDB().Preload("Customer").Preload("Consultant").
-		Preload("Items").Preload("Items.Project").
-		Preload("Items.MainDoctor").Preload("Items.Nurse1").Preload("Items.Nurse2").
-		First(&visit, id).Error; err != nil {
+	visit, err := loadVisitDetail(config.GetDB(), uint(id))
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "就诊记录不存在"})
 		return
 	}
@@ -91,6 +100,7 @@ func GetVisit(c *gin.Context) {
 }
 
 // CreateVisit 创建就诊
+// 可通过 items 一并提交明细，单据、明细及业绩分配在同一事务中写入
 func CreateVisit(c *gin.Context) {
 	var visit models.Visit
 	if err := c.ShouldBindJSON(&visit); err != nil {
@@ -115,14 +125,46 @@ func CreateVisit(c *gin.Context) {
 	now := time.Now()
 	visit.CreatedAt = &now
 	visit.UpdatedAt = &now
+	items := visit.Items
+	visit.Items = nil
+	visit.Payments = nil
+	visit.TotalAmount = 0
+	visit.PaidAmount = 0
+	visit.PaymentStatus = models.PaymentStatusUnpaid
+
+	// 新建单据一律为草稿，确认和作废通过单独的接口操作
+	visit.Status = models.VisitStatusDraft
+	visit.CustomerType = nil
+	visit.ConfirmedAt, visit.ConfirmedBy = nil, nil
+	visit.VoidedAt, visit.VoidedBy, visit.VoidReason = nil, nil, nil
 
-	if err := config.GetDB().Create(&visit).Error; err != nil {
+	tx := config.GetDB().Begin()
+	if err := tx.Omit("Items").Create(&visit).Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建失败: " + err.Error()})
 		return
 	}
 
+	errs, err := createVisitItems(tx, &visit, items)
+	if len(errs) > 0 {
+		tx.Rollback()
+		respondValidationErrors(c, errs)
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建明细失败: " + err.Error()})
+		return
+	}
+	if err := refreshVisitTotal(tx, visit.ID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新总金额失败"})
+		return
+	}
+	tx.Commit()
+
 	// 重新加载关联数据
-	config.GetDB().Preload("Customer").Preload("Consultant").First(&visit, visit.ID)
+	visit, _ = loadVisitDetail(config.GetDB(), visit.ID)
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
@@ -131,7 +173,8 @@ func CreateVisit(c *gin.Context) {
 	})
 }
 
-// UpdateVisit 更新就诊
+// UpdateVisit 更新就诊（仅草稿）
+// 请求中带 items 时整体替换原有明细（含业绩分配），不带时只更新单据字段
 func UpdateVisit(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
@@ -144,6 +187,10 @@ func UpdateVisit(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "就诊记录不存在"})
 		return
 	}
+	if !visit.Editable() {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "就诊单据" + visitStatusText(visit.Status) + "，不可修改"})
+		return
+	}
 
 	var input models.Visit
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -154,19 +201,76 @@ func UpdateVisit(c *gin.Context) {
 	// 更新时间
 	now := time.Now()
 	input.UpdatedAt = &now
+	items := input.Items
+	input.Items = nil
+	input.Payments = nil
+	input.TotalAmount = 0
+	input.PaidAmount = 0
+	input.PaymentStatus = ""
+	input.Status = ""
+	input.CustomerType = nil
+	input.ConfirmedAt, input.ConfirmedBy = nil, nil
+	originalCustomerID := visit.CustomerID
+	consultantChanged := input.ConsultantID != nil &&
+		(visit.ConsultantID == nil || *visit.ConsultantID != *input.ConsultantID)
+	dateChanged := !input.VisitDate.IsZero() && !input.VisitDate.Equal(visit.VisitDate)
+	input.VoidedAt, input.VoidedBy, input.VoidReason = nil, nil, nil
 
-	if err := config.GetDB().Model(&visit).Updates(input).Error; err != nil {
+	tx := config.GetDB().Begin()
+	if err := tx.Model(&visit).Omit("Items").Updates(input).Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新失败"})
 		return
 	}
 
+	if items != nil {
+		if err := removeVisitItems(tx, visit.ID); err != nil {
+			tx.Rollback()
+			if errors.Is(err, errPackageRedeemed) {
+				c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "删除原明细失败"})
+			return
+		}
+		errs, err := createVisitItems(tx, &visit, items)
+		if len(errs) > 0 {
+			tx.Rollback()
+			respondValidationErrors(c, errs)
+			return
+		}
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建明细失败: " + err.Error()})
+			return
+		}
+	} else if consultantChanged || dateChanged {
+		// 咨询师业绩随单据的咨询师变化，适用的提成方案随就诊日期变化
+		if err := recalculateVisitPerformance(tx, visit.ID); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "业绩计算失败: " + err.Error()})
+			return
+		}
+	}
+
 	// 更新总金额（根据明细自动计算）
-	var totalAmount float64
-	config.GetDB().Model(&models.VisitItem{}).Where("visit_id = ?", id).Select("COALESCE(SUM(amount), 0)").Scan(&totalAmount)
-	config.GetDB().Model(&visit).Update("total_amount", totalAmount)
+	if err := refreshVisitTotal(tx, visit.ID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新总金额失败"})
+		return
+	}
+	// 更换顾客时原顾客的分类也需重新计算
+	if input.CustomerID != 0 && input.CustomerID != originalCustomerID {
+		if err := refreshCustomerClassification(tx, originalCustomerID); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新顾客分类失败"})
+			return
+		}
+	}
+	tx.Commit()
 
 	// 重新加载
-	config.GetDB().Preload("Customer").Preload("Consultant").Preload("Items").First(&visit, id)
+	visit, _ = loadVisitDetail(config.GetDB(), visit.ID)
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
@@ -175,7 +279,7 @@ func UpdateVisit(c *gin.Context) {
 	})
 }
 
-// DeleteVisit 删除就诊（软删除）
+// DeleteVisit 删除就诊（软删除，仅草稿）
 func DeleteVisit(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
@@ -183,10 +287,30 @@ func DeleteVisit(c *gin.Context) {
 		return
 	}
 
+	var visit models.Visit
+	if err := config.GetDB().First(&visit, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "就诊记录不存在"})
+		return
+	}
+	if !visit.Editable() {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "就诊单据" + visitStatusText(visit.Status) + "，不可删除"})
+		return
+	}
+	var paymentCount int64
+	config.GetDB().Model(&models.Payment{}).Where("visit_id = ?", id).Count(&paymentCount)
+	if paymentCount > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "就诊单据已有收款记录，请先删除收款"})
+		return
+	}
+
 	// 使用事务删除就诊及其明细
 	tx := config.GetDB().Begin()
-	if err := tx.Where("visit_id = ?", id).Delete(&models.VisitItem{}).Error; err != nil {
+	if err := removeVisitItems(tx, uint(id)); err != nil {
 		tx.Rollback()
+		if errors.Is(err, errPackageRedeemed) {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "删除明细失败"})
 		return
 	}
@@ -196,6 +320,11 @@ func DeleteVisit(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "删除失败"})
 		return
 	}
+	if err := refreshCustomerClassification(tx, visit.CustomerID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新顾客分类失败"})
+		return
+	}
 
 	tx.Commit()
 
@@ -204,3 +333,101 @@ func DeleteVisit(c *gin.Context) {
 		"message": "删除成功",
 	})
 }
+
+// loadVisitDetail 加载就诊及其明细、参与人员
+func loadVisitDetail(db *gorm.DB, id uint) (models.Visit, error) {
+	var visit models.Visit
+	err := db.Preload("Customer").Preload("Consultant").
+		Preload("Items").Preload("Items.Project").
+		Preload("Items.MainDoctor").Preload("Items.Nurse1").Preload("Items.Nurse2").Preload("Items.ApprovedBy").
+		Preload("Items.Allocations").Preload("Items.Allocations.Employee").
+		Preload("Payments", func(db *gorm.DB) *gorm.DB { return db.Order("paid_at") }).
+		First(&visit, id).Error
+	return visit, err
+}
+
+// refreshVisitTotal 根据明细重新计算就诊总金额，并同步收款状态和顾客分类
+func refreshVisitTotal(tx *gorm.DB, visitID uint) error {
+	var visit models.Visit
+	if err := tx.Select("id", "customer_id").First(&visit, visitID).Error; err != nil {
+		return err
+	}
+	var totalAmount models.Money
+	if err := tx.Model(&models.VisitItem{}).Where("visit_id = ?", visitID).
+		Select("COALESCE(SUM(amount), 0)").Scan(&totalAmount).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.Visit{}).Where("id = ?", visitID).Update("total_amount", totalAmount).Error; err != nil {
+		return err
+	}
+	if err := refreshVisitPayments(tx, visitID); err != nil {
+		return err
+	}
+	return refreshCustomerClassification(tx, visit.CustomerID)
+}
+
+// createVisitItems 在事务中为就诊创建明细并计算业绩分配
+// 校验失败时返回字段错误（字段名带 items[i]. 前缀），此时调用方应回滚事务
+func createVisitItems(tx *gorm.DB, visit *models.Visit, items []models.VisitItem) ([]FieldError, error) {
+	var errs []FieldError
+	now := time.Now()
+	for i := range items {
+		item := &items[i]
+		item.ID = 0
+		item.VisitID = visit.ID
+		item.CreatedAt = &now
+		item.UpdatedAt = &now
+
+		itemErrs := priceVisitItem(tx, item)
+		itemErrs = append(itemErrs, validateVisitItem(tx, item, len(item.Allocations) == 0)...)
+		for _, e := range itemErrs {
+			e.Field = fmt.Sprintf("items[%d].%s", i, e.Field)
+			errs = append(errs, e)
+		}
+	}
+	if len(errs) > 0 {
+		return errs, nil
+	}
+
+	for i := range items {
+		itemErrs, err := insertVisitItem(tx, &items[i])
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range itemErrs {
+			e.Field = fmt.Sprintf("items[%d].%s", i, e.Field)
+			errs = append(errs, e)
+		}
+	}
+	return errs, nil
+}
+
+// releaseVisitItems 撤销单据所有明细的疗程操作并退回优惠券（删除明细或作废单据时）
+// 单据售卖的疗程已在其他单据消耗时返回 errPackageRedeemed
+func releaseVisitItems(tx *gorm.DB, visitID uint) error {
+	var items []models.VisitItem
+	if err := tx.Where("visit_id = ? AND (package_id IS NOT NULL OR customer_package_id IS NOT NULL OR coupon_id IS NOT NULL)", visitID).
+		Find(&items).Error; err != nil {
+		return err
+	}
+	for i := range items {
+		if err := releaseVisitItem(tx, &items[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeVisitItems 删除就诊下的全部明细及业绩分配（软删除），并撤销明细的疗程操作、退回优惠券
+// 售卖的疗程已有消耗时返回 errPackageRedeemed
+func removeVisitItems(tx *gorm.DB, visitID uint) error {
+	if err := releaseVisitItems(tx, visitID); err != nil {
+		return err
+	}
+
+	if err := tx.Where("visit_item_id IN (?)", tx.Model(&models.VisitItem{}).Select("id").Where("visit_id = ?", visitID)).
+		Delete(&models.VisitItemAllocation{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("visit_id = ?", visitID).Delete(&models.VisitItem{}).Error
+}
@@ -1,11 +1,13 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 	"skin-performance/config"
 	"skin-performance/models"
 )
@@ -15,7 +17,8 @@ func ListVisitItems(c *gin.Context) {
 	var items []models.VisitItem
 	query := config.GetDB().Model(&models.VisitItem{}).
 		Preload("Project").Preload("MainDoctor").
-		Preload("Nurse1").Preload("Nurse2")
+		Preload("Nurse1").Preload("Nurse2").
+		Preload("Allocations").Preload("Allocations.Employee")
 
 	if visitID := c.Query("visit_id"); visitID != "" {
 		query = query.Where("visit_id = ?", visitID)
@@ -55,7 +58,8 @@ func GetVisitItem(c *gin.Context) {
 	}
 
 	var item models.VisitItem
-	if err := config.GetDB().Preload("Project").Preload("MainDoctor").First(&item, id).Error; err != nil {
+	if err := config.GetDB().Preload("Project").Preload("MainDoctor").
+		Preload("Allocations").Preload("Allocations.Employee").First(&item, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "明细记录不存在"})
 		return
 	}
@@ -75,28 +79,42 @@ func CreateVisitItem(c *gin.Context) {
 		return
 	}
 
-	if item.VisitID == 0 || item.ProjectID == 0 || item.Amount <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误"})
-		return
-	}
-
-	// 业绩分配计算
-	calculatePerformance(&item)
-
 	now := time.Now()
 	item.CreatedAt = &now
 	item.UpdatedAt = &now
 
+	if msg := ensureVisitEditable(config.GetDB(), item.VisitID); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": msg})
+		return
+	}
+
 	tx := config.GetDB().Begin()
-	if err := tx.Create(&item).Error; err != nil {
+	errs := priceVisitItem(tx, &item)
+	errs = append(errs, validateVisitItem(tx, &item, len(item.Allocations) == 0)...)
+	if len(errs) > 0 {
+		tx.Rollback()
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	// 疗程处理、业绩分配计算并保存
+	errs, err := insertVisitItem(tx, &item)
+	if len(errs) > 0 {
 		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建失败"})
+		respondValidationErrors(c, errs)
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建失败: " + err.Error()})
 		return
 	}
 
-	var totalAmount float64
-	tx.Model(&models.VisitItem{}).Where("visit_id = ?", item.VisitID).Select("COALESCE(SUM(amount), 0)").Scan(&totalAmount)
-	tx.Model(&models.Visit{}).Where("id = ?", item.VisitID).Update("total_amount", totalAmount)
+	if err := refreshVisitTotal(tx, item.VisitID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新总金额失败"})
+		return
+	}
 	tx.Commit()
 
 	c.JSON(http.StatusOK, gin.H{
@@ -126,15 +144,109 @@ func UpdateVisitItem(c *gin.Context) {
 		return
 	}
 
-	calculatePerformance(&input)
+	// 原单据和目标单据都必须是草稿
+	for _, visitID := range []uint{item.VisitID, input.VisitID} {
+		if msg := ensureVisitEditable(config.GetDB(), visitID); visitID != 0 && msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": msg})
+			return
+		}
+	}
+
+	// 疗程明细的项目和金额关系到已购疗程，只能删除后重新录入
+	if item.PackageID != nil || item.CustomerPackageID != nil {
+		if (input.ProjectID != 0 && input.ProjectID != item.ProjectID) || (input.Amount != 0 && input.Amount != item.Amount) {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "疗程明细不能修改项目和金额，请删除后重新录入"})
+			return
+		}
+	}
+	input.PackageID = nil
+	input.CustomerPackageID = nil
+	input.PackageSessionNo = 0
+
 	now := time.Now()
 	input.UpdatedAt = &now
 
-	if err := config.GetDB().Model(&item).Updates(input).Error; err != nil {
+	// 分配记录单独处理：请求中带 allocations 时整体替换；
+	// 只修改了旧的固定人员字段时按固定字段重建；否则沿用已有分配
+	allocations := input.Allocations
+	input.Allocations = nil
+	legacyChanged := input.MainDoctorID != 0 || input.CoDoctor1ID != nil || input.CoDoctor2ID != nil ||
+		input.Nurse1ID != nil || input.Nurse2ID != nil || input.CoRatio1 != 0 || input.CoRatio2 != 0
+
+	// 价格相关字段有变化时重新定价；只提交成交金额视为手工改价
+	pricingChanged := input.ListPrice != 0 || input.DiscountType != "" || input.DiscountRate != 0 ||
+		input.DiscountAmount != 0 || input.CouponCode != nil || input.Amount != 0 ||
+		input.ProjectID != 0 || input.ApprovedByID != nil
+	manualAmount := input.Amount != 0 && input.DiscountType == ""
+	original := item
+
+	tx := config.GetDB().Begin()
+	if err := tx.Model(&item).Updates(input).Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新失败"})
 		return
 	}
 
+	// 按更新后的明细重新计算业绩
+	if err := tx.Preload("Allocations").First(&item, id).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新失败"})
+		return
+	}
+	if len(allocations) > 0 {
+		item.Allocations = allocations
+	} else if legacyChanged {
+		item.Allocations = item.LegacyAllocations()
+	}
+	var errs []FieldError
+	if pricingChanged {
+		if manualAmount {
+			item.DiscountType = models.DiscountTypeNone
+		}
+		if err := releaseItemCoupon(tx, &original); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "退回优惠券失败"})
+			return
+		}
+		errs = priceVisitItem(tx, &item)
+	}
+	errs = append(errs, validateVisitItem(tx, &item, len(allocations) == 0 && legacyChanged)...)
+	if len(errs) > 0 {
+		tx.Rollback()
+		respondValidationErrors(c, errs)
+		return
+	}
+	if err := calculatePerformance(tx, &item); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "业绩计算失败: " + err.Error()})
+		return
+	}
+	columns := append(append([]string{}, performanceColumns...), pricingColumns...)
+	if err := tx.Model(&item).Select(columns).Updates(&item).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新失败"})
+		return
+	}
+	if err := saveAllocations(tx, &item); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "保存业绩分配失败"})
+		return
+	}
+
+	// 明细移到其他单据时原单据的总金额同样需要更新
+	visitIDs := []uint{item.VisitID}
+	if original.VisitID != item.VisitID {
+		visitIDs = append(visitIDs, original.VisitID)
+	}
+	for _, visitID := range visitIDs {
+		if err := refreshVisitTotal(tx, visitID); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新总金额失败"})
+			return
+		}
+	}
+	tx.Commit()
+
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "更新成功",
@@ -157,12 +269,36 @@ func DeleteVisitItem(c *gin.Context) {
 	}
 
 	visitID := item.VisitID
-	tx := config.GetDB().Begin()
-	tx.Delete(&item)
+	if msg := ensureVisitEditable(config.GetDB(), visitID); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": msg})
+		return
+	}
 
-	var totalAmount float64
-	tx.Model(&models.VisitItem{}).Where("visit_id = ?", visitID).Select("COALESCE(SUM(amount), 0)").Scan(&totalAmount)
-	tx.Model(&models.Visit{}).Where("id = ?", visitID).Update("total_amount", totalAmount)
+	tx := config.GetDB().Begin()
+	if err := releaseVisitItem(tx, &item); err != nil {
+		tx.Rollback()
+		if errors.Is(err, errPackageRedeemed) {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "撤销疗程或优惠券失败"})
+		return
+	}
+	if err := tx.Where("visit_item_id = ?", item.ID).Delete(&models.VisitItemAllocation{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "删除业绩分配失败"})
+		return
+	}
+	if err := tx.Delete(&item).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "删除失败"})
+		return
+	}
+	if err := refreshVisitTotal(tx, visitID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新总金额失败"})
+		return
+	}
 	tx.Commit()
 
 	c.JSON(http.StatusOK, gin.H{
@@ -171,26 +307,34 @@ func DeleteVisitItem(c *gin.Context) {
 	})
 }
 
-// calculatePerformance 计算业绩分配
-func calculatePerformance(item *models.VisitItem) {
-	coTotalRatio := item.CoRatio1 + item.CoRatio2
-	if coTotalRatio > 1 {
-		coTotalRatio = 1
-	}
-	item.MainDoctorPerformance = item.Amount * (1 - coTotalRatio)
-
-	if item.CoDoctor1ID != nil {
-		item.CoDoctor1Performance = item.Amount * item.CoRatio1
+// insertVisitItem 保存已通过校验的明细：处理疗程售卖/消耗、计算业绩并保存分配记录
+// 疗程校验失败时返回字段错误，此时调用方应回滚事务
+func insertVisitItem(tx *gorm.DB, item *models.VisitItem) ([]FieldError, error) {
+	var visit models.Visit
+	if err := tx.First(&visit, item.VisitID).Error; err != nil {
+		return nil, err
 	}
-	if item.CoDoctor2ID != nil {
-		item.CoDoctor2Performance = item.Amount * item.CoRatio2
+	if errs, err := preparePackageItem(tx, item, &visit); len(errs) > 0 || err != nil {
+		return errs, err
 	}
 
-	nurseRatio := 0.05
-	if item.Nurse1ID != nil {
-		item.Nurse1Performance = item.Amount * nurseRatio
+	if err := calculatePerformance(tx, item); err != nil {
+		return nil, err
+	}
+	if err := tx.Omit("Allocations", "Package", "CustomerPackage").Create(item).Error; err != nil {
+		return nil, err
 	}
-	if item.Nurse2ID != nil {
-		item.Nurse2Performance = item.Amount * nurseRatio
+	if err := saveAllocations(tx, item); err != nil {
+		return nil, err
 	}
+	return nil, createSoldPackage(tx, item, &visit)
+}
+
+// performanceColumns 重新计算业绩时需要回写的字段
+var performanceColumns = []string{
+	"main_doctor_id", "co_doctor1_id", "co_doctor2_id", "nurse1_id", "nurse2_id",
+	"co_ratio1", "co_ratio2",
+	"main_doctor_performance", "co_doctor1_performance", "co_doctor2_performance",
+	"nurse1_performance", "nurse2_performance",
+	"commission_plan_id",
 }
@@ -0,0 +1,212 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"skin-performance/models"
+)
+
+// FieldError 字段级校验错误，前端根据 Field 定位表单项
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Validation error codes
+const (
+	ErrCodeRequired             = "required"
+	ErrCodeNotFound             = "not_found"
+	ErrCodeInactive             = "inactive"
+	ErrCodeInvalidAmount        = "invalid_amount"
+	ErrCodeInvalidRatio         = "invalid_ratio"
+	ErrCodeRatioExceeded        = "ratio_exceeded"
+	ErrCodeInvalidRole          = "invalid_role"
+	ErrCodeRoleMismatch         = "role_mismatch"
+	ErrCodeDuplicateParticipant = "duplicate_participant"
+	ErrCodeDuplicateMainDoctor  = "duplicate_main_doctor"
+	ErrCodePackageMismatch      = "package_mismatch"
+	ErrCodePackageExpired       = "package_expired"
+	ErrCodePackageUsedUp        = "package_used_up"
+	ErrCodeInvalidDiscount      = "invalid_discount"
+	ErrCodeCouponUnavailable    = "coupon_unavailable"
+)
+
+// respondValidationErrors 返回字段级校验错误
+func respondValidationErrors(c *gin.Context, errs []FieldError) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"code":    400,
+		"message": errs[0].Message,
+		"errors":  errs,
+	})
+}
+
+// allocationFields 分配记录对应的请求字段名
+// 通过旧的固定字段提交时映射回 main_doctor_id/co_doctor1_id 等，否则为 allocations[i].xxx
+func allocationFields(item *models.VisitItem, legacy bool) (employeeFields, ratioFields []string) {
+	employeeFields = make([]string, len(item.Allocations))
+	ratioFields = make([]string, len(item.Allocations))
+	coCount, nurseCount := 0, 0
+	for i, a := range item.Allocations {
+		if !legacy {
+			employeeFields[i] = fmt.Sprintf("allocations[%d].employee_id", i)
+			ratioFields[i] = fmt.Sprintf("allocations[%d].ratio", i)
+			continue
+		}
+		switch a.RoleInItem {
+		case models.CommissionRoleMainDoctor:
+			employeeFields[i] = "main_doctor_id"
+		case models.CommissionRoleCoDoctor:
+			coCount++
+			employeeFields[i] = fmt.Sprintf("co_doctor%d_id", coCount)
+			ratioFields[i] = fmt.Sprintf("co_ratio%d", coCount)
+		case models.CommissionRoleNurse:
+			nurseCount++
+			employeeFields[i] = fmt.Sprintf("nurse%d_id", nurseCount)
+		}
+	}
+	return employeeFields, ratioFields
+}
+
+// requiredEmployeeRole 各提成角色要求的员工岗位
+func requiredEmployeeRole(roleInItem string) string {
+	if roleInItem == models.CommissionRoleNurse {
+		return models.RoleNurse
+	}
+	return models.RoleDoctor
+}
+
+// validateVisitItem 校验就诊明细及其参与人员，返回所有字段错误
+// item.Allocations 为空时按旧的固定字段生成后校验；legacy 表示参与人员来自旧的固定字段
+func validateVisitItem(db *gorm.DB, item *models.VisitItem, legacy bool) []FieldError {
+	var errs []FieldError
+	add := func(field, code, message string) {
+		errs = append(errs, FieldError{Field: field, Code: code, Message: message})
+	}
+
+	if item.VisitID == 0 {
+		add("visit_id", ErrCodeRequired, "请选择就诊单据")
+	} else {
+		var visit models.Visit
+		if err := db.Select("id", "consultant_id").First(&visit, item.VisitID).Error; err != nil {
+			add("visit_id", ErrCodeNotFound, "就诊单据不存在")
+		} else if visit.ConsultantID != nil {
+			// 咨询师分配由单据的咨询师生成，校验该咨询师
+			var consultant models.Employee
+			if err := db.First(&consultant, *visit.ConsultantID).Error; err != nil {
+				add("consultant_id", ErrCodeNotFound, "咨询师不存在")
+			} else {
+				if !consultant.IsActive {
+					add("consultant_id", ErrCodeInactive, fmt.Sprintf("员工%s已停用", consultant.Name))
+				}
+				if consultant.Role != models.RoleConsultant {
+					add("consultant_id", ErrCodeRoleMismatch, fmt.Sprintf("%s不是%s", consultant.Name, models.RoleConsultant))
+				}
+			}
+		}
+	}
+
+	if item.ProjectID == 0 {
+		add("project_id", ErrCodeRequired, "请选择项目")
+	} else {
+		var project models.Project
+		if err := db.First(&project, item.ProjectID).Error; err != nil {
+			add("project_id", ErrCodeNotFound, "项目不存在")
+		} else if !project.IsActive {
+			add("project_id", ErrCodeInactive, "项目已停用")
+		}
+	}
+
+	// 消耗已购疗程的明细可以不再收费
+	if item.Amount < 0 || (item.Amount == 0 && item.CustomerPackageID == nil) {
+		add("amount", ErrCodeInvalidAmount, "金额必须大于0")
+	}
+
+	if len(item.Allocations) == 0 {
+		item.Allocations = item.LegacyAllocations()
+		legacy = true
+	}
+	employeeFields, ratioFields := allocationFields(item, legacy)
+
+	// 加载参与员工
+	ids := make([]uint, 0, len(item.Allocations))
+	for _, a := range item.Allocations {
+		ids = append(ids, a.EmployeeID)
+	}
+	employees := make(map[uint]models.Employee)
+	if len(ids) > 0 {
+		var list []models.Employee
+		db.Where("id IN ?", ids).Find(&list)
+		for _, e := range list {
+			employees[e.ID] = e
+		}
+	}
+
+	mainCount := 0
+	coTotalRatio := 0.0
+	lastRatioField := ""
+	seen := make(map[uint]bool)
+	for i, a := range item.Allocations {
+		field := employeeFields[i]
+
+		if !models.IsCommissionRole(a.RoleInItem) {
+			add(fmt.Sprintf("allocations[%d].role_in_item", i), ErrCodeInvalidRole, "无效的参与角色")
+			continue
+		}
+		// 咨询师分配由就诊单据的咨询师生成（见 setConsultantAllocation），请求中的咨询师分配会被替换
+		if a.RoleInItem == models.CommissionRoleConsultant {
+			continue
+		}
+		if a.RoleInItem == models.CommissionRoleMainDoctor {
+			mainCount++
+			if mainCount > 1 {
+				add(field, ErrCodeDuplicateMainDoctor, "每条明细只能有一位主操医生")
+			}
+		}
+		if a.RoleInItem == models.CommissionRoleCoDoctor {
+			if a.Ratio < 0 || a.Ratio > 1 {
+				add(ratioFields[i], ErrCodeInvalidRatio, "协同比例必须在0到1之间")
+			}
+			coTotalRatio += a.Ratio
+			lastRatioField = ratioFields[i]
+		}
+
+		if a.EmployeeID == 0 {
+			add(field, ErrCodeRequired, "请选择参与人员")
+			continue
+		}
+		if seen[a.EmployeeID] {
+			add(field, ErrCodeDuplicateParticipant, "同一员工不能在明细中重复参与")
+			continue
+		}
+		seen[a.EmployeeID] = true
+
+		employee, ok := employees[a.EmployeeID]
+		if !ok {
+			add(field, ErrCodeNotFound, "员工不存在")
+			continue
+		}
+		if !employee.IsActive {
+			add(field, ErrCodeInactive, fmt.Sprintf("员工%s已停用", employee.Name))
+		}
+		if want := requiredEmployeeRole(a.RoleInItem); employee.Role != want {
+			add(field, ErrCodeRoleMismatch, fmt.Sprintf("%s不是%s", employee.Name, want))
+		}
+	}
+
+	if mainCount == 0 {
+		if legacy {
+			add("main_doctor_id", ErrCodeRequired, "请选择主操医生")
+		} else {
+			add("allocations", ErrCodeRequired, "请选择主操医生")
+		}
+	}
+	if coTotalRatio > 1 {
+		add(lastRatioField, ErrCodeRatioExceeded, "协同比例合计不能超过1")
+	}
+
+	return errs
+}
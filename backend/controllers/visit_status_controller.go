@@ -0,0 +1,261 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"skin-performance/config"
+	"skin-performance/models"
+)
+
+// currentUserID 当前登录用户ID，未登录时返回 nil
+func currentUserID(c *gin.Context) *uint {
+	v, ok := c.Get("userID")
+	if !ok {
+		return nil
+	}
+	id, ok := v.(uint)
+	if !ok {
+		return nil
+	}
+	return &id
+}
+
+// visitStatusText 就诊状态的中文描述
+func visitStatusText(status string) string {
+	switch status {
+	case models.VisitStatusConfirmed:
+		return "已确认"
+	case models.VisitStatusVoided:
+		return "已作废"
+	default:
+		return "草稿"
+	}
+}
+
+// ensureVisitEditable 检查就诊单据是否允许修改明细，不允许时返回错误信息
+func ensureVisitEditable(db *gorm.DB, visitID uint) string {
+	var visit models.Visit
+	if err := db.Select("id", "status").First(&visit, visitID).Error; err != nil {
+		// 单据不存在由明细校验给出字段错误
+		return ""
+	}
+	if !visit.Editable() {
+		return "就诊单据" + visitStatusText(visit.Status) + "，不可修改"
+	}
+	return ""
+}
+
+// transitionVisit 按条件更新就诊状态，单据当前状态不是 from 时返回 false
+func transitionVisit(db *gorm.DB, id uint64, from string, updates map[string]interface{}) (bool, error) {
+	updates["updated_at"] = time.Now()
+	result := db.Model(&models.Visit{}).Where("id = ? AND status = ?", id, from).Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
+
+// refreshVisitCustomerClassification 单据状态变更后重新计算其顾客的分类
+func refreshVisitCustomerClassification(tx *gorm.DB, visitID uint64) error {
+	var visit models.Visit
+	if err := tx.Select("id", "customer_id").First(&visit, visitID).Error; err != nil {
+		return err
+	}
+	return refreshCustomerClassification(tx, visit.CustomerID)
+}
+
+// respondVisitTransition 返回状态变更结果
+func respondVisitTransition(c *gin.Context, id uint64, ok bool, err error, from, message string) {
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新状态失败"})
+		return
+	}
+	if !ok {
+		var visit models.Visit
+		if err := config.GetDB().First(&visit, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "就诊记录不存在"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "就诊单据" + visitStatusText(visit.Status) + "，只能操作" + visitStatusText(from) + "单据",
+		})
+		return
+	}
+
+	visit, _ := loadVisitDetail(config.GetDB(), uint(id))
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": message,
+		"data":    visit,
+	})
+}
+
+// ConfirmVisit 确认就诊单据（草稿 → 已确认），确认后的单据计入业绩报表
+// 确认时按就诊日期有效的提成方案重新计算业绩，并重新计算顾客分类；就诊日期所在月份已结算时不能确认
+func ConfirmVisit(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	var itemCount int64
+	config.GetDB().Model(&models.VisitItem{}).Where("visit_id = ?", id).Count(&itemCount)
+	if itemCount == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "就诊单据没有明细，不能确认"})
+		return
+	}
+
+	tx := config.GetDB().Begin()
+	ok, err := transitionVisit(tx, id, models.VisitStatusDraft, map[string]interface{}{
+		"status":       models.VisitStatusConfirmed,
+		"confirmed_at": time.Now(),
+		"confirmed_by": currentUserID(c),
+	})
+	if ok && err == nil {
+		err = ensureVisitMonthOpen(tx, id)
+		if errors.Is(err, errVisitMonthSettled) {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+			return
+		}
+	}
+	// 按确认时有效的提成方案重新计算业绩
+	if ok && err == nil {
+		err = recalculateVisitPerformance(tx, uint(id))
+	}
+	if ok && err == nil {
+		err = refreshVisitCustomerClassification(tx, id)
+	}
+	if ok && err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	respondVisitTransition(c, id, ok, err, models.VisitStatusDraft, "确认成功")
+}
+
+// VoidVisitRequest 作废就诊请求
+type VoidVisitRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// VoidVisit 作废就诊单据（已确认 → 已作废），作废后不再计入业绩且不可恢复，并重新计算顾客分类
+// 作废时撤销明细的疗程操作：售卖的疗程删除（已在其他单据消耗时不能作废），消耗的次数退回，使用的优惠券退回
+// 就诊日期所在月份已结算或单据已有收款时不能作废
+func VoidVisit(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	var req VoidVisitRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Reason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请填写作废原因"})
+		return
+	}
+	reason := strings.TrimSpace(req.Reason)
+
+	// 疗程、优惠券的撤销和顾客分类的重新计算与状态变更在同一事务中完成
+	tx := config.GetDB().Begin()
+	ok, err := transitionVisit(tx, id, models.VisitStatusConfirmed, map[string]interface{}{
+		"status":      models.VisitStatusVoided,
+		"voided_at":   time.Now(),
+		"voided_by":   currentUserID(c),
+		"void_reason": reason,
+	})
+	if ok && err == nil {
+		err = ensureVisitMonthOpen(tx, id)
+		if errors.Is(err, errVisitMonthSettled) {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+			return
+		}
+	}
+	// 已有收款的单据需先删除收款（储值收款随之冲回余额）再作废；状态更新已锁定单据，并发收款会看到已作废
+	if ok && err == nil {
+		var paymentCount int64
+		err = tx.Model(&models.Payment{}).Where("visit_id = ?", id).Count(&paymentCount).Error
+		if err == nil && paymentCount > 0 {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "就诊单据已有收款，请先删除收款记录再作废"})
+			return
+		}
+	}
+	if ok && err == nil {
+		err = releaseVisitItems(tx, uint(id))
+		if errors.Is(err, errPackageRedeemed) {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+			return
+		}
+	}
+	if ok && err == nil {
+		err = refreshVisitCustomerClassification(tx, id)
+	}
+	if ok && err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	respondVisitTransition(c, id, ok, err, models.VisitStatusConfirmed, "作废成功")
+}
+
+// ReopenVisit 撤回已确认的就诊单据为草稿（仅管理员），撤回后可修改明细并重新确认，并重新计算顾客分类
+// 已有退款的单据不能撤回，避免修改明细后与退款冲减的业绩不一致；售卖的疗程已被消耗的单据同样不能撤回
+// 就诊日期所在月份已结算时不能撤回
+func ReopenVisit(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return
+	}
+
+	var refundCount int64
+	config.GetDB().Model(&models.Refund{}).
+		Where("visit_item_id IN (?)", config.GetDB().Model(&models.VisitItem{}).Select("id").Where("visit_id = ?", id)).
+		Count(&refundCount)
+	if refundCount > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "就诊单据已有退款，不能撤回"})
+		return
+	}
+	// 撤回后明细可被修改或删除，售卖的疗程已在其他单据消耗时不能撤回
+	redeemed, err := soldPackageRedeemed(config.GetDB(), uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询疗程消耗失败"})
+		return
+	}
+	if redeemed {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "就诊单据售卖的疗程已有消耗记录，不能撤回"})
+		return
+	}
+
+	tx := config.GetDB().Begin()
+	ok, err := transitionVisit(tx, id, models.VisitStatusConfirmed, map[string]interface{}{
+		"status":       models.VisitStatusDraft,
+		"confirmed_at": nil,
+		"confirmed_by": nil,
+	})
+	if ok && err == nil {
+		err = ensureVisitMonthOpen(tx, id)
+		if errors.Is(err, errVisitMonthSettled) {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+			return
+		}
+	}
+	if ok && err == nil {
+		err = refreshVisitCustomerClassification(tx, id)
+	}
+	if ok && err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	respondVisitTransition(c, id, ok, err, models.VisitStatusConfirmed, "撤回成功")
+}
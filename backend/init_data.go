@@ -21,7 +21,7 @@ func initAdminUser() {
 	employee := models.Employee{
 		Name:     "系统管理员",
 		Role:     models.RoleAdmin,
-		Phone:    stringPtr("13800138000"),
+		Phone:    (*models.Phone)(stringPtr("13800138000")),
 		JobNumber: stringPtr("ADMIN001"),
 		IsActive: true,
 	}
@@ -2,10 +2,12 @@ package main
 
 import (
 	"log"
+	"os"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"skin-performance/config"
+	"skin-performance/controllers"
 	"skin-performance/routes"
 	"skin-performance/utils"
 	"skin-performance/models"
@@ -35,6 +37,17 @@ func main() {
 	}
 	log.Println("数据库迁移完成")
 
+	// 子命令：按历史就诊记录回填顾客类型和初诊日期后退出
+	// 用法：./server backfill-customer-types
+	if len(os.Args) > 1 && os.Args[1] == "backfill-customer-types" {
+		count, err := controllers.BackfillCustomerClassification(db)
+		if err != nil {
+			log.Fatalf("回填顾客类型失败: %v", err)
+		}
+		log.Printf("回填顾客类型完成，共处理 %d 位顾客", count)
+		return
+	}
+
 	// 初始化管理员用户（如果不存在）
 	db = config.GetDB()
 	var existingUser models.User
@@ -43,7 +56,7 @@ func main() {
 		employee := models.Employee{
 			Name:     "系统管理员",
 			Role:     models.RoleAdmin,
-			Phone:    ptr("13800138000"),
+			Phone:    (*models.Phone)(ptr("13800138000")),
 			JobNumber: ptr("ADMIN001"),
 			IsActive: true,
 		}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Channel 顾客来源渠道字典，如大众点评、小红书、自然到店、老客转介绍
+type Channel struct {
+	ID        uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	Code      string         `gorm:"type:varchar(32);not null;uniqueIndex:uniq_code" json:"code"`
+	Name      string         `gorm:"type:varchar(64);not null" json:"name"`
+	SortOrder int            `gorm:"default:0" json:"sort_order"`
+	IsActive  bool           `gorm:"default:true" json:"is_active"`
+	Remark    *string        `gorm:"type:varchar(255)" json:"remark,omitempty"`
+	CreatedAt *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+func (Channel) TableName() string {
+	return "channels"
+}
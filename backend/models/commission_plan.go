@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CommissionPlan 提成方案版本
+// 每个版本有独立的有效期和规则集，明细按就诊日期匹配当时有效的版本计算业绩。
+type CommissionPlan struct {
+	ID        uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name      string         `gorm:"type:varchar(64);not null;uniqueIndex:uniq_name_version" json:"name"`
+	Version   int            `gorm:"not null;uniqueIndex:uniq_name_version" json:"version"`
+	ValidFrom time.Time      `gorm:"type:date;not null;index:idx_valid_from" json:"valid_from"`
+	ValidTo   *time.Time     `gorm:"type:date" json:"valid_to,omitempty"`
+	IsActive  bool           `gorm:"default:true" json:"is_active"`
+	Remark    *string        `gorm:"type:text" json:"remark,omitempty"`
+	CreatedAt *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Relationships
+	Rules []CommissionRule `gorm:"foreignKey:PlanID" json:"rules,omitempty"`
+}
+
+func (CommissionPlan) TableName() string {
+	return "commission_plans"
+}
+
+// ValidOn 判断方案在指定日期是否有效
+func (p CommissionPlan) ValidOn(t time.Time) bool {
+	if !p.IsActive {
+		return false
+	}
+	day := t.Format("2006-01-02")
+	if day < p.ValidFrom.Format("2006-01-02") {
+		return false
+	}
+	if p.ValidTo != nil && day > p.ValidTo.Format("2006-01-02") {
+		return false
+	}
+	return true
+}
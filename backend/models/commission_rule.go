@@ -0,0 +1,77 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CommissionRule 提成规则
+// 按参与角色配置比例，可限定到项目分类或具体项目，并带有生效日期区间。
+// 匹配时具体项目优先于项目分类，项目分类优先于通用规则，同一层级按优先级从高到低。
+// 规则归属于某个提成方案版本；未归属方案的规则仅在没有有效方案时使用。
+type CommissionRule struct {
+	ID              uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	PlanID          *uint          `gorm:"index:idx_plan_id" json:"plan_id,omitempty"`
+	Name            string         `gorm:"type:varchar(64);not null" json:"name"`
+	Role            string         `gorm:"type:varchar(20);not null;index:idx_role" json:"role"`
+	ProjectCategory *string        `gorm:"type:varchar(50);index:idx_project_category" json:"project_category,omitempty"`
+	ProjectID       *uint          `gorm:"index:idx_project_id" json:"project_id,omitempty"`
+	Ratio           float64        `gorm:"type:decimal(5,4);not null" json:"ratio"`
+	Priority        int            `gorm:"default:0" json:"priority"`
+	EffectiveFrom   *time.Time     `gorm:"type:date" json:"effective_from,omitempty"`
+	EffectiveTo     *time.Time     `gorm:"type:date" json:"effective_to,omitempty"`
+	IsActive        bool           `gorm:"default:true" json:"is_active"`
+	Remark          *string        `gorm:"type:text" json:"remark,omitempty"`
+	CreatedAt       *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt       *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Relationships
+	Plan    *CommissionPlan `gorm:"foreignKey:PlanID" json:"plan,omitempty"`
+	Project *Project        `gorm:"foreignKey:ProjectID" json:"project,omitempty"`
+}
+
+// Commission role constants
+const (
+	CommissionRoleMainDoctor = "main_doctor" // 主操医生：扣除协同比例后剩余部分中的分成比例
+	CommissionRoleCoDoctor   = "co_doctor"   // 协同医生：明细未填写协同比例时的默认比例
+	CommissionRoleNurse      = "nurse"       // 护士：按明细金额计算的比例
+	CommissionRoleConsultant = "consultant"  // 咨询师：就诊单据的咨询师，按明细金额计算的比例
+)
+
+// Default commission ratios used when no rule matches
+const (
+	DefaultMainDoctorRatio = 1.0
+	DefaultCoDoctorRatio   = 0.0
+	DefaultNurseRatio      = 0.05
+	DefaultConsultantRatio = 0.0
+)
+
+func (CommissionRule) TableName() string {
+	return "commission_rules"
+}
+
+// IsCommissionRole 判断是否为合法的提成角色
+func IsCommissionRole(role string) bool {
+	switch role {
+	case CommissionRoleMainDoctor, CommissionRoleCoDoctor, CommissionRoleNurse, CommissionRoleConsultant:
+		return true
+	}
+	return false
+}
+
+// EffectiveOn 判断规则在指定日期是否生效
+func (r CommissionRule) EffectiveOn(t time.Time) bool {
+	if !r.IsActive {
+		return false
+	}
+	day := t.Format("2006-01-02")
+	if r.EffectiveFrom != nil && day < r.EffectiveFrom.Format("2006-01-02") {
+		return false
+	}
+	if r.EffectiveTo != nil && day > r.EffectiveTo.Format("2006-01-02") {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CommissionTier 阶梯提成档位
+// 按员工月度分配业绩累进计算：落在 [LowerBound, UpperBound) 区间内的部分按 Rate 提成，
+// UpperBound 为空表示无上限。档位归属于提成方案版本，未归属方案的档位仅在没有有效方案时使用。
+type CommissionTier struct {
+	ID         uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	PlanID     *uint          `gorm:"index:idx_plan_id" json:"plan_id,omitempty"`
+	Role       string         `gorm:"type:varchar(20);not null;index:idx_role" json:"role"`
+	LowerBound Money          `gorm:"type:decimal(12,2);not null;default:0" json:"lower_bound"`
+	UpperBound *Money         `gorm:"type:decimal(12,2)" json:"upper_bound,omitempty"`
+	Rate       float64        `gorm:"type:decimal(5,4);not null" json:"rate"`
+	IsActive   bool           `gorm:"default:true" json:"is_active"`
+	Remark     *string        `gorm:"type:text" json:"remark,omitempty"`
+	CreatedAt  *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt  *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Relationships
+	Plan *CommissionPlan `gorm:"foreignKey:PlanID" json:"plan,omitempty"`
+}
+
+func (CommissionTier) TableName() string {
+	return "commission_tiers"
+}
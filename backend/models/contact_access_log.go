@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+// Contact subject type constants
+const (
+	ContactSubjectCustomer = "customer"
+	ContactSubjectEmployee = "employee"
+)
+
+// ContactAccessLog 联系方式访问日志，只增不改
+// 有查看联系方式权限的用户每读取一条未脱敏的电话记录一条，Action 为读取的接口（list、detail、reveal、export）
+type ContactAccessLog struct {
+	ID          uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID      *uint      `gorm:"index:idx_user_id" json:"user_id,omitempty"`
+	Username    string     `gorm:"type:varchar(32)" json:"username"`
+	Role        string     `gorm:"type:varchar(20)" json:"role"`
+	SubjectType string     `gorm:"type:varchar(20);not null;index:idx_subject,priority:1" json:"subject_type"`
+	SubjectID   uint       `gorm:"not null;index:idx_subject,priority:2" json:"subject_id"`
+	Action      string     `gorm:"type:varchar(20);not null" json:"action"`
+	Path        string     `gorm:"type:varchar(255)" json:"path"`
+	IP          string     `gorm:"type:varchar(64)" json:"ip"`
+	CreatedAt   *time.Time `gorm:"index:idx_created_at" json:"created_at,omitempty"`
+}
+
+func (ContactAccessLog) TableName() string {
+	return "contact_access_logs"
+}
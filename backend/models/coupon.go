@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Coupon 优惠券定义
+// DiscountType 为 percentage 时按 DiscountRate 折扣（0.8 表示八折），为 fixed 时立减 DiscountAmount；
+// UsageLimit 为 0 表示不限使用次数，UsedCount 在明细使用/删除时增减
+type Coupon struct {
+	ID             uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	Code           string         `gorm:"type:varchar(32);not null;uniqueIndex:uniq_code" json:"code"`
+	Name           string         `gorm:"type:varchar(100);not null" json:"name"`
+	DiscountType   string         `gorm:"type:varchar(16);not null" json:"discount_type"`
+	DiscountRate   float64        `gorm:"type:decimal(5,4);default:0" json:"discount_rate"`
+	DiscountAmount Money          `gorm:"type:decimal(10,2);default:0" json:"discount_amount"`
+	MinAmount      Money          `gorm:"type:decimal(10,2);default:0" json:"min_amount"`
+	ProjectID      *uint          `gorm:"index:idx_project_id" json:"project_id,omitempty"`
+	ValidFrom      *time.Time     `json:"valid_from,omitempty"`
+	ValidTo        *time.Time     `json:"valid_to,omitempty"`
+	UsageLimit     int            `gorm:"default:0" json:"usage_limit"`
+	UsedCount      int            `gorm:"default:0" json:"used_count"`
+	IsActive       bool           `gorm:"default:true" json:"is_active"`
+	Remark         *string        `gorm:"type:text" json:"remark,omitempty"`
+	CreatedAt      *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt      *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Relationships
+	Project *Project `gorm:"foreignKey:ProjectID" json:"project,omitempty"`
+}
+
+func (Coupon) TableName() string {
+	return "coupons"
+}
+
+// ValidOn 在 t 时是否处于有效期内，ValidTo 当天全天有效
+func (c *Coupon) ValidOn(t time.Time) bool {
+	if c.ValidFrom != nil && t.Before(*c.ValidFrom) {
+		return false
+	}
+	if c.ValidTo != nil {
+		y, m, d := c.ValidTo.Date()
+		if !t.Before(time.Date(y, m, d, 0, 0, 0, 0, c.ValidTo.Location()).AddDate(0, 0, 1)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Discount 按优惠券计算标价为 price 时的优惠金额，不超过标价
+func (c *Coupon) Discount(price Money) Money {
+	var discount Money
+	switch c.DiscountType {
+	case DiscountTypePercentage:
+		discount = price - price.MulRatio(c.DiscountRate)
+	case DiscountTypeFixed:
+		discount = c.DiscountAmount
+	}
+	if discount > price {
+		discount = price
+	}
+	return discount
+}
@@ -5,18 +5,47 @@ import (
 	"gorm.io/gorm"
 )
 
+// Customer 顾客
+// CustomerType 和 FirstVisitDate 由就诊记录自动计算，不能手工修改
+// ChannelID 为来源渠道，ReferrerID 为介绍该顾客的老顾客
+// Phone 加密存储，PhoneHash、PhoneSuffixHash 为完整号码和后4位的盲索引，用于查询和唯一约束
 type Customer struct {
-	ID             uint           `gorm:"primaryKey;autoIncrement" json:"id"`
-	Name           string         `gorm:"type:varchar(64);not null" json:"name"`
-	Phone          string         `gorm:"type:varchar(20);not null;uniqueIndex:uniq_phone" json:"phone"`
-	CustomerType   *string        `gorm:"type:varchar(20)" json:"customer_type,omitempty"`
-	FirstVisitDate *time.Time     `gorm:"type:date" json:"first_visit_date,omitempty"`
-	Remark         *string        `gorm:"type:text" json:"remark,omitempty"`
-	CreatedAt      *time.Time     `json:"created_at,omitempty"`
-	UpdatedAt      *time.Time     `json:"updated_at,omitempty"`
-	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+	ID              uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name            string         `gorm:"type:varchar(64);not null" json:"name"`
+	Phone           Phone          `gorm:"type:varchar(128);not null" json:"phone"`
+	PhoneHash       *string        `gorm:"type:char(64);uniqueIndex:uniq_phone_hash" json:"-"`
+	PhoneSuffixHash *string        `gorm:"type:char(64);index:idx_phone_suffix_hash" json:"-"`
+	CustomerType    *string        `gorm:"type:varchar(20)" json:"customer_type,omitempty"`
+	FirstVisitDate  *time.Time     `gorm:"type:date" json:"first_visit_date,omitempty"`
+	ChannelID       *uint          `gorm:"index:idx_channel_id" json:"channel_id,omitempty"`
+	ReferrerID      *uint          `gorm:"index:idx_referrer_id" json:"referrer_id,omitempty"`
+	Remark          *string        `gorm:"type:text" json:"remark,omitempty"`
+	CreatedAt       *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt       *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Relationships
+	Channel  *Channel  `gorm:"foreignKey:ChannelID" json:"channel,omitempty"`
+	Referrer *Customer `gorm:"foreignKey:ReferrerID" json:"referrer,omitempty"`
+	Tags     []Tag     `gorm:"many2many:customer_tags" json:"tags,omitempty"`
 }
 
+// Customer type constants
+const (
+	CustomerTypeNew    = "初诊"  // 第一次就诊
+	CustomerTypeReturn = "复诊"  // 再次就诊，此前没有过消费
+	CustomerTypeRepeat = "再消费" // 再次就诊，此前已有过消费
+)
+
 func (Customer) TableName() string {
 	return "customers"
 }
+
+// SetPhone 设置电话（只保留数字）并更新盲索引
+func (c *Customer) SetPhone(phone string) {
+	digits := NormalizePhone(phone)
+	hash, suffixHash := PhoneHash(digits), PhoneSuffixHash(digits)
+	c.Phone = Phone(digits)
+	c.PhoneHash = &hash
+	c.PhoneSuffixHash = &suffixHash
+}
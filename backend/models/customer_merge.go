@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// CustomerMergeLog 顾客合并记录，只增不改
+// 合并时被合并顾客（Loser）的就诊、已购疗程、介绍的顾客改为归属保留顾客（Survivor），储值余额转入保留顾客，
+// 被合并顾客软删除。LoserSnapshot 保存合并前被合并顾客的资料（JSON），MovedVisitIDs 等记录迁移的数据（JSON 数组）供复核
+type CustomerMergeLog struct {
+	ID                 uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	SurvivorID         uint       `gorm:"not null;index:idx_survivor_id" json:"survivor_id"`
+	LoserID            uint       `gorm:"not null;index:idx_loser_id" json:"loser_id"`
+	LoserSnapshot      string     `gorm:"type:text;not null" json:"loser_snapshot"`
+	MovedVisitIDs      string     `gorm:"type:text" json:"moved_visit_ids"`
+	MovedPackageIDs    string     `gorm:"type:text" json:"moved_package_ids"`
+	MovedReferralIDs   string     `gorm:"type:text" json:"moved_referral_ids"`
+	TransferredBalance Money      `gorm:"type:decimal(12,2);default:0" json:"transferred_balance"`
+	Reason             *string    `gorm:"type:varchar(255)" json:"reason,omitempty"`
+	OperatorID         *uint      `json:"operator_id,omitempty"`
+	CreatedAt          *time.Time `gorm:"index:idx_created_at" json:"created_at,omitempty"`
+
+	// Relationships
+	Survivor *Customer `gorm:"foreignKey:SurvivorID" json:"survivor,omitempty"`
+}
+
+func (CustomerMergeLog) TableName() string {
+	return "customer_merge_logs"
+}
@@ -5,13 +5,14 @@ import (
 	"gorm.io/gorm"
 )
 
+// Employee 员工，Phone 加密存储
 type Employee struct {
 	ID         uint           `gorm:"primaryKey;autoIncrement" json:"id"`
 	Name       string         `gorm:"type:varchar(32);not null" json:"name"`
 	Role       string         `gorm:"type:varchar(20);not null;index:idx_role" json:"role"`
 	Department *string        `gorm:"type:varchar(50)" json:"department,omitempty"`
 	JobNumber  *string        `gorm:"type:varchar(32);uniqueIndex:uniq_job_number" json:"job_number,omitempty"`
-	Phone      *string        `gorm:"type:varchar(20)" json:"phone,omitempty"`
+	Phone      *Phone         `gorm:"type:varchar(128)" json:"phone,omitempty"`
 	IsActive   bool           `gorm:"default:true" json:"is_active"`
 	Remark     *string        `gorm:"type:text" json:"remark,omitempty"`
 	CreatedAt  *time.Time     `json:"created_at,omitempty"`
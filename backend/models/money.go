@@ -0,0 +1,189 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Money 金额，以分为单位的定点数，对应数据库 decimal(x,2) 字段
+//
+// 舍入规则：按比例计算金额时四舍五入到分（0.5 分向远离零的方向进位）。
+// 需要把一笔金额拆分成多份时，舍入产生的尾差统一由一个确定的份额（如主操医生）承担，
+// 保证各部分之和等于总额。JSON 中仍以数字输出（如 123.45），兼容原有接口。
+type Money int64
+
+// ratioScale 比例精度，对应数据库 decimal(5,4)
+const ratioScale = 10000
+
+// NewMoneyFromFloat 由浮点数金额构造，四舍五入到分
+func NewMoneyFromFloat(f float64) Money {
+	return Money(math.Round(f * 100))
+}
+
+// ParseMoney 解析金额字符串，如 "123.45"、"-0.5"
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+
+	negative := false
+	if s[0] == '-' || s[0] == '+' {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if intPart == "" {
+		intPart = "0"
+	}
+	yuan, err := strconv.ParseInt(intPart, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("无效的金额: %q", s)
+	}
+
+	// 超过两位的小数按第三位四舍五入
+	var cents int64
+	for i := 0; i < 3 && i < len(fracPart); i++ {
+		d := fracPart[i]
+		if d < '0' || d > '9' {
+			return 0, fmt.Errorf("无效的金额: %q", s)
+		}
+		switch i {
+		case 0:
+			cents += int64(d-'0') * 10
+		case 1:
+			cents += int64(d - '0')
+		case 2:
+			if d >= '5' {
+				cents++
+			}
+		}
+	}
+
+	m := Money(yuan*100 + cents)
+	if negative {
+		m = -m
+	}
+	return m, nil
+}
+
+// Cents 返回以分为单位的整数
+func (m Money) Cents() int64 {
+	return int64(m)
+}
+
+// Float64 返回以元为单位的浮点数，仅用于展示或比例计算
+func (m Money) Float64() float64 {
+	return float64(m) / 100
+}
+
+// String 格式化为两位小数，如 "123.45"
+func (m Money) String() string {
+	sign := ""
+	v := int64(m)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/100, v%100)
+}
+
+// MulRatio 按比例计算金额，比例精确到万分位，结果四舍五入到分
+func (m Money) MulRatio(ratio float64) Money {
+	r := int64(math.Round(ratio * ratioScale))
+	product := int64(m) * r
+	half := int64(ratioScale / 2)
+	if product >= 0 {
+		return Money((product + half) / ratioScale)
+	}
+	return Money(-((-product + half) / ratioScale))
+}
+
+// Prorate 按 part/total 的比例折算金额（m × part ÷ total），结果四舍五入到分
+// 与 MulRatio 不同，比例不做截断，part 等于 total 时结果与 m 完全相等
+func (m Money) Prorate(part, total Money) Money {
+	if total == 0 {
+		return 0
+	}
+	num := new(big.Int).Mul(big.NewInt(int64(m)), big.NewInt(int64(part)))
+	den := big.NewInt(int64(total))
+	negative := num.Sign()*den.Sign() < 0
+	num.Abs(num)
+	den.Abs(den)
+
+	// 四舍五入：(2*num + den) / (2*den)
+	num.Mul(num, big.NewInt(2)).Add(num, den)
+	den.Mul(den, big.NewInt(2))
+	q := num.Quo(num, den).Int64()
+	if negative {
+		q = -q
+	}
+	return Money(q)
+}
+
+// Ratio 返回 m 占 total 的比例，total 为 0 时返回 0
+func (m Money) Ratio(total Money) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(m) / float64(total)
+}
+
+// MarshalJSON 以数字形式输出
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON 支持数字和字符串两种形式
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" {
+		*m = 0
+		return nil
+	}
+	v, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// Scan 实现 sql.Scanner
+func (m *Money) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*m = 0
+	case []byte:
+		parsed, err := ParseMoney(string(v))
+		if err != nil {
+			return err
+		}
+		*m = parsed
+	case string:
+		parsed, err := ParseMoney(v)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+	case float64:
+		*m = NewMoneyFromFloat(v)
+	case float32:
+		*m = NewMoneyFromFloat(float64(v))
+	case int64:
+		*m = Money(v * 100)
+	default:
+		return fmt.Errorf("无法将 %T 转换为金额", value)
+	}
+	return nil
+}
+
+// Value 实现 driver.Valuer，以十进制字符串写入避免浮点误差
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
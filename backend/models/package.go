@@ -0,0 +1,85 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Package 疗程套餐，如"光子嫩肤 6 次"
+// 以某个项目为基础，约定次数、售价和有效期；RecognitionPolicy 决定业绩在售卖时一次确认，还是按每次消耗确认
+type Package struct {
+	ID                uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name              string         `gorm:"type:varchar(100);not null;uniqueIndex:uniq_name" json:"name"`
+	ProjectID         uint           `gorm:"not null;index:idx_project_id" json:"project_id"`
+	Sessions          int            `gorm:"not null" json:"sessions"`
+	Price             Money          `gorm:"type:decimal(10,2);not null" json:"price"`
+	ValidDays         int            `gorm:"default:0" json:"valid_days"`
+	RecognitionPolicy string         `gorm:"type:varchar(16);not null;default:sale" json:"recognition_policy"`
+	IsActive          bool           `gorm:"default:true" json:"is_active"`
+	Remark            *string        `gorm:"type:text" json:"remark,omitempty"`
+	CreatedAt         *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt         *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt         gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Relationships
+	Project Project `gorm:"foreignKey:ProjectID" json:"project,omitempty"`
+}
+
+// Recognition policy constants
+const (
+	RecognitionAtSale     = "sale"    // 售卖时按售价确认业绩，消耗时不再计业绩
+	RecognitionPerSession = "session" // 售卖时不计业绩，每次消耗按单次价值确认业绩
+)
+
+func (Package) TableName() string {
+	return "packages"
+}
+
+// IsRecognitionPolicy 是否为支持的业绩确认方式
+func IsRecognitionPolicy(policy string) bool {
+	return policy == RecognitionAtSale || policy == RecognitionPerSession
+}
+
+// CustomerPackage 顾客购买的疗程
+// 由售卖套餐的就诊明细生成，售价、次数和业绩确认方式在购买时固定下来，之后修改套餐不影响已购疗程
+type CustomerPackage struct {
+	ID                uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	CustomerID        uint           `gorm:"not null;index:idx_customer_id" json:"customer_id"`
+	PackageID         uint           `gorm:"not null;index:idx_package_id" json:"package_id"`
+	ProjectID         uint           `gorm:"not null" json:"project_id"`
+	SaleVisitItemID   uint           `gorm:"not null;uniqueIndex:uniq_sale_visit_item_id" json:"sale_visit_item_id"`
+	TotalSessions     int            `gorm:"not null" json:"total_sessions"`
+	RemainingSessions int            `gorm:"not null" json:"remaining_sessions"`
+	Price             Money          `gorm:"type:decimal(10,2);not null" json:"price"`
+	RecognitionPolicy string         `gorm:"type:varchar(16);not null" json:"recognition_policy"`
+	PurchasedAt       time.Time      `gorm:"not null" json:"purchased_at"`
+	ExpiresAt         *time.Time     `gorm:"index:idx_expires_at" json:"expires_at,omitempty"`
+	CreatedAt         *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt         *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt         gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Relationships
+	Customer *Customer `gorm:"foreignKey:CustomerID" json:"customer,omitempty"`
+	Package  *Package  `gorm:"foreignKey:PackageID" json:"package,omitempty"`
+	Project  *Project  `gorm:"foreignKey:ProjectID" json:"project,omitempty"`
+}
+
+func (CustomerPackage) TableName() string {
+	return "customer_packages"
+}
+
+// ExpiredAt 在 t 时是否已过期
+func (p *CustomerPackage) ExpiredAt(t time.Time) bool {
+	return p.ExpiresAt != nil && t.After(*p.ExpiresAt)
+}
+
+// SessionValue 第 n 次（从1开始）消耗对应的价值
+// 按售价平均分摊到每次，各次取累计分摊额之差，保证所有次数之和等于售价
+func (p *CustomerPackage) SessionValue(n int) Money {
+	if p.TotalSessions <= 0 || n < 1 || n > p.TotalSessions {
+		return 0
+	}
+	total := Money(p.TotalSessions)
+	return p.Price.Prorate(Money(n), total) - p.Price.Prorate(Money(n-1), total)
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Payment 就诊收款记录，一张单据可以分多笔、多种方式收款
+type Payment struct {
+	ID         uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	VisitID    uint           `gorm:"not null;index:idx_visit_id" json:"visit_id"`
+	Method     string         `gorm:"type:varchar(20);not null;index:idx_method" json:"method"`
+	Amount     Money          `gorm:"type:decimal(10,2);not null" json:"amount"`
+	PaidAt     time.Time      `gorm:"not null;index:idx_paid_at" json:"paid_at"`
+	Remark     *string        `gorm:"type:varchar(255)" json:"remark,omitempty"`
+	OperatorID *uint          `json:"operator_id,omitempty"`
+	CreatedAt  *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt  *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// Payment method constants
+const (
+	PaymentMethodCash    = "cash"
+	PaymentMethodWechat  = "wechat"
+	PaymentMethodAlipay  = "alipay"
+	PaymentMethodCard    = "card"
+	PaymentMethodPrepaid = "prepaid"
+)
+
+// Payment status constants
+const (
+	PaymentStatusUnpaid  = "unpaid"
+	PaymentStatusPartial = "partial"
+	PaymentStatusPaid    = "paid"
+)
+
+func (Payment) TableName() string {
+	return "payments"
+}
+
+// IsPaymentMethod 是否为支持的收款方式
+func IsPaymentMethod(method string) bool {
+	switch method {
+	case PaymentMethodCash, PaymentMethodWechat, PaymentMethodAlipay, PaymentMethodCard, PaymentMethodPrepaid:
+		return true
+	}
+	return false
+}
+
+// PaymentStatusOf 根据应收和实收金额得出收款状态
+func PaymentStatusOf(total, paid Money) string {
+	switch {
+	case paid <= 0 && total > 0:
+		return PaymentStatusUnpaid
+	case paid < total:
+		return PaymentStatusPartial
+	default:
+		return PaymentStatusPaid
+	}
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PerformanceSettlement 员工月度业绩结算
+// BaseAmount 为当月分配到该员工的业绩合计，Commission 为按阶梯档位计算的提成，
+// Brackets 保存各档位的计算明细（JSON）。重新结算时旧记录软删除保留，新记录的 Version 递增。
+type PerformanceSettlement struct {
+	ID               uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	EmployeeID       uint           `gorm:"not null;uniqueIndex:uniq_employee_month_version" json:"employee_id"`
+	Month            string         `gorm:"type:varchar(7);not null;uniqueIndex:uniq_employee_month_version;index:idx_month" json:"month"`
+	Version          int            `gorm:"not null;default:1;uniqueIndex:uniq_employee_month_version" json:"version"`
+	BaseAmount       Money          `gorm:"type:decimal(12,2);default:0" json:"base_amount"`
+	Commission       Money          `gorm:"type:decimal(12,2);default:0" json:"commission"`
+	EffectiveRate    float64        `gorm:"type:decimal(5,4);default:0" json:"effective_rate"`
+	CommissionPlanID *uint          `json:"commission_plan_id,omitempty"`
+	Brackets         string         `gorm:"type:text" json:"brackets"`
+	SettledAt        time.Time      `gorm:"not null" json:"settled_at"`
+	SettledBy        *uint          `json:"settled_by,omitempty"`
+	CreatedAt        *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt        *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Relationships
+	Employee Employee `gorm:"foreignKey:EmployeeID" json:"employee,omitempty"`
+}
+
+func (PerformanceSettlement) TableName() string {
+	return "performance_settlements"
+}
@@ -0,0 +1,164 @@
+package models
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// PhoneCipherPrefix 电话密文前缀，没有前缀的值视为加密前写入的明文
+const PhoneCipherPrefix = "v1:"
+
+var (
+	phoneAEAD     cipher.AEAD
+	phoneIndexKey []byte
+)
+
+// MinPhoneKeyLength 电话加密密钥和盲索引密钥的最小长度
+const MinPhoneKeyLength = 32
+
+// InitPhoneCrypto 设置电话加密密钥和盲索引密钥，两者均由配置的字符串经 SHA-256 派生
+// 密钥缺失、过短或两者相同时返回错误，调用方应终止启动
+func InitPhoneCrypto(encryptionKey, indexKey string) error {
+	if encryptionKey == "" || indexKey == "" {
+		return errors.New("未配置 PHONE_ENCRYPTION_KEY 或 PHONE_INDEX_KEY")
+	}
+	if len(encryptionKey) < MinPhoneKeyLength || len(indexKey) < MinPhoneKeyLength {
+		return fmt.Errorf("PHONE_ENCRYPTION_KEY 和 PHONE_INDEX_KEY 长度不能少于%d个字符", MinPhoneKeyLength)
+	}
+	if encryptionKey == indexKey {
+		return errors.New("PHONE_ENCRYPTION_KEY 和 PHONE_INDEX_KEY 不能相同")
+	}
+	key := sha256.Sum256([]byte(encryptionKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	idx := sha256.Sum256([]byte(indexKey))
+	phoneAEAD = aead
+	phoneIndexKey = idx[:]
+	return nil
+}
+
+// Phone 电话号码，写入数据库时以 AES-GCM 加密，读取时解密
+// 输出 JSON 时默认脱敏（138****8000），有查看联系方式权限的接口需显式输出明文并记录访问日志
+type Phone string
+
+// NormalizePhone 只保留电话中的数字
+func NormalizePhone(phone string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+}
+
+// Masked 脱敏后的电话：保留前3位和后4位
+func (p Phone) Masked() string {
+	d := NormalizePhone(string(p))
+	switch {
+	case d == "":
+		return ""
+	case len(d) >= 7:
+		return d[:3] + "****" + d[len(d)-4:]
+	case len(d) > 2:
+		return strings.Repeat("*", len(d)-2) + d[len(d)-2:]
+	default:
+		return "****"
+	}
+}
+
+// IsMasked 是否为脱敏后的值（编辑时原样提交的脱敏电话不应覆盖原号码）
+func (p Phone) IsMasked() bool {
+	return strings.Contains(string(p), "*")
+}
+
+// MarshalJSON 默认输出脱敏电话
+func (p Phone) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.Masked())
+}
+
+// Value 加密后存储
+func (p Phone) Value() (driver.Value, error) {
+	if p == "" {
+		return "", nil
+	}
+	if phoneAEAD == nil {
+		return nil, errors.New("电话加密密钥未初始化")
+	}
+	nonce := make([]byte, phoneAEAD.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := phoneAEAD.Seal(nonce, nonce, []byte(p), nil)
+	return PhoneCipherPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Scan 读取并解密
+func (p *Phone) Scan(value interface{}) error {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		*p = ""
+		return nil
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return errors.New("无法解析电话")
+	}
+	if !strings.HasPrefix(s, PhoneCipherPrefix) {
+		*p = Phone(s)
+		return nil
+	}
+	if phoneAEAD == nil {
+		return errors.New("电话加密密钥未初始化")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(s, PhoneCipherPrefix))
+	if err != nil || len(sealed) < phoneAEAD.NonceSize() {
+		return errors.New("电话密文格式错误")
+	}
+	nonceSize := phoneAEAD.NonceSize()
+	plain, err := phoneAEAD.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return errors.New("电话解密失败")
+	}
+	*p = Phone(plain)
+	return nil
+}
+
+// phoneIndex 计算盲索引：带密钥的 HMAC-SHA256，不能由索引反推号码
+func phoneIndex(kind, digits string) string {
+	mac := hmac.New(sha256.New, phoneIndexKey)
+	mac.Write([]byte(kind + ":" + digits))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// PhoneHash 完整号码的盲索引，用于精确查询和唯一约束
+func PhoneHash(phone string) string {
+	return phoneIndex("full", NormalizePhone(phone))
+}
+
+// PhoneSuffixHash 号码后4位的盲索引，用于按尾号查询
+func PhoneSuffixHash(phone string) string {
+	d := NormalizePhone(phone)
+	if len(d) > 4 {
+		d = d[len(d)-4:]
+	}
+	return phoneIndex("suffix", d)
+}
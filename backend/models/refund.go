@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Refund 退款单
+// 关联一条就诊明细，支持全额或部分退款。退款按金额比例为原参与人员生成负数业绩（RefundAllocation），
+// 业绩计入退款日期所在期间，原明细及其业绩保持不变。
+type Refund struct {
+	ID          uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	VisitItemID uint           `gorm:"not null;index:idx_visit_item_id" json:"visit_item_id"`
+	Amount      Money          `gorm:"type:decimal(10,2);not null" json:"amount"`
+	RefundDate  time.Time      `gorm:"not null;index:idx_refund_date" json:"refund_date"`
+	Reason      *string        `gorm:"type:varchar(255)" json:"reason,omitempty"`
+	OperatorID  *uint          `json:"operator_id,omitempty"`
+	CreatedAt   *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt   *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Relationships
+	VisitItem   *VisitItem         `gorm:"foreignKey:VisitItemID" json:"visit_item,omitempty"`
+	Allocations []RefundAllocation `gorm:"foreignKey:RefundID" json:"allocations,omitempty"`
+}
+
+func (Refund) TableName() string {
+	return "refunds"
+}
+
+// RefundAllocation 退款冲减的业绩，Performance 为负数
+type RefundAllocation struct {
+	ID          uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	RefundID    uint           `gorm:"not null;index:idx_refund_id" json:"refund_id"`
+	VisitItemID uint           `gorm:"not null;index:idx_visit_item_id" json:"visit_item_id"`
+	EmployeeID  uint           `gorm:"not null;index:idx_employee_id" json:"employee_id"`
+	RoleInItem  string         `gorm:"type:varchar(20);not null" json:"role_in_item"`
+	Ratio       float64        `gorm:"type:decimal(5,4);default:0" json:"ratio"`
+	Performance Money          `gorm:"type:decimal(10,2);default:0" json:"performance"`
+	CreatedAt   *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt   *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Relationships
+	Employee *Employee `gorm:"foreignKey:EmployeeID" json:"employee,omitempty"`
+}
+
+func (RefundAllocation) TableName() string {
+	return "refund_allocations"
+}
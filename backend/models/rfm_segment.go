@@ -0,0 +1,96 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RFMSegment 顾客分群定义，按最近就诊天数（R）、就诊次数（F）、消费金额（M）的区间划分
+// 条件为空表示不限；一位顾客可能满足多个分群，取 Priority 最高的一个
+type RFMSegment struct {
+	ID             uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	Code           string         `gorm:"type:varchar(32);not null;uniqueIndex:uniq_code" json:"code"`
+	Name           string         `gorm:"type:varchar(64);not null" json:"name"`
+	RecencyDaysMin *int           `json:"recency_days_min,omitempty"`
+	RecencyDaysMax *int           `json:"recency_days_max,omitempty"`
+	FrequencyMin   *int           `json:"frequency_min,omitempty"`
+	FrequencyMax   *int           `json:"frequency_max,omitempty"`
+	MonetaryMin    *Money         `gorm:"type:decimal(12,2)" json:"monetary_min,omitempty"`
+	MonetaryMax    *Money         `gorm:"type:decimal(12,2)" json:"monetary_max,omitempty"`
+	Priority       int            `gorm:"default:0" json:"priority"`
+	Description    *string        `gorm:"type:varchar(255)" json:"description,omitempty"`
+	IsActive       bool           `gorm:"default:true" json:"is_active"`
+	CreatedAt      *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt      *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+func (RFMSegment) TableName() string {
+	return "rfm_segments"
+}
+
+// Matches 顾客的 RFM 指标是否落在分群区间内
+func (s *RFMSegment) Matches(recencyDays, frequency int, monetary Money) bool {
+	if s.RecencyDaysMin != nil && recencyDays < *s.RecencyDaysMin {
+		return false
+	}
+	if s.RecencyDaysMax != nil && recencyDays > *s.RecencyDaysMax {
+		return false
+	}
+	if s.FrequencyMin != nil && frequency < *s.FrequencyMin {
+		return false
+	}
+	if s.FrequencyMax != nil && frequency > *s.FrequencyMax {
+		return false
+	}
+	if s.MonetaryMin != nil && monetary < *s.MonetaryMin {
+		return false
+	}
+	if s.MonetaryMax != nil && monetary > *s.MonetaryMax {
+		return false
+	}
+	return true
+}
+
+// RFM 评分分档：各指标按分档得 1–5 分，5 分最好
+var (
+	// RecencyScoreDays 最近就诊天数不超过各档天数时依次得 5、4、3、2 分，超过最后一档得 1 分
+	RecencyScoreDays = []int{30, 60, 90, 180}
+	// FrequencyScoreCounts 就诊次数达到各档次数时依次得 2、3、4、5 分
+	FrequencyScoreCounts = []int{2, 3, 5, 8}
+	// MonetaryScoreAmounts 消费金额达到各档金额（1000、5000、10000、30000元）时依次得 2、3、4、5 分
+	MonetaryScoreAmounts = []Money{100000, 500000, 1000000, 3000000}
+)
+
+// RecencyScore 最近就诊天数的得分
+func RecencyScore(days int) int {
+	for i, limit := range RecencyScoreDays {
+		if days <= limit {
+			return 5 - i
+		}
+	}
+	return 1
+}
+
+// FrequencyScore 就诊次数的得分
+func FrequencyScore(count int) int {
+	score := 1
+	for _, limit := range FrequencyScoreCounts {
+		if count >= limit {
+			score++
+		}
+	}
+	return score
+}
+
+// MonetaryScore 消费金额的得分
+func MonetaryScore(amount Money) int {
+	score := 1
+	for _, limit := range MonetaryScoreAmounts {
+		if amount >= limit {
+			score++
+		}
+	}
+	return score
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StoredValueAccount 顾客储值账户，每位顾客一个
+// 余额只能通过储值流水变动，变动时需在事务中锁定账户行
+type StoredValueAccount struct {
+	ID         uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	CustomerID uint           `gorm:"not null;uniqueIndex:uniq_customer_id" json:"customer_id"`
+	Balance    Money          `gorm:"type:decimal(12,2);not null;default:0" json:"balance"`
+	CreatedAt  *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt  *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Relationships
+	Customer *Customer `gorm:"foreignKey:CustomerID" json:"customer,omitempty"`
+}
+
+func (StoredValueAccount) TableName() string {
+	return "stored_value_accounts"
+}
+
+// StoredValueTransaction 储值流水，只增不改
+// Amount 为余额变动额：充值和消费冲回为正，消费和退卡为负
+type StoredValueTransaction struct {
+	ID            uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	AccountID     uint       `gorm:"not null;index:idx_account_id" json:"account_id"`
+	CustomerID    uint       `gorm:"not null;index:idx_customer_id" json:"customer_id"`
+	Type          string     `gorm:"type:varchar(16);not null;index:idx_type" json:"type"`
+	Amount        Money      `gorm:"type:decimal(12,2);not null" json:"amount"`
+	BalanceAfter  Money      `gorm:"type:decimal(12,2);not null" json:"balance_after"`
+	PaymentMethod *string    `gorm:"type:varchar(20)" json:"payment_method,omitempty"`
+	VisitID       *uint      `gorm:"index:idx_visit_id" json:"visit_id,omitempty"`
+	PaymentID     *uint      `gorm:"index:idx_payment_id" json:"payment_id,omitempty"`
+	Remark        *string    `gorm:"type:varchar(255)" json:"remark,omitempty"`
+	OperatorID    *uint      `json:"operator_id,omitempty"`
+	CreatedAt     *time.Time `gorm:"index:idx_created_at" json:"created_at,omitempty"`
+}
+
+// Stored value transaction types
+const (
+	StoredValueTopUp    = "topup"     // 充值
+	StoredValueConsume  = "consume"   // 消费（收款方式为储值）
+	StoredValueReverse  = "reverse"   // 消费冲回（删除储值收款）
+	StoredValueRefund   = "refund"    // 退卡，余额退还顾客
+	StoredValueMergeOut = "merge_out" // 顾客合并，余额转出到保留顾客
+	StoredValueMergeIn  = "merge_in"  // 顾客合并，余额从被合并顾客转入
+)
+
+func (StoredValueTransaction) TableName() string {
+	return "stored_value_transactions"
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Tag 顾客标签，如敏感肌、VIP、过敏史
+// 顾客与标签为多对多关系，关联表为 customer_tags；删除标签时一并解除与顾客的关联
+type Tag struct {
+	ID        uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name      string     `gorm:"type:varchar(32);not null;uniqueIndex:uniq_name" json:"name"`
+	Color     *string    `gorm:"type:varchar(16)" json:"color,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+func (Tag) TableName() string {
+	return "tags"
+}
+
+// Tag match mode constants
+const (
+	TagModeAnd = "and" // 同时具有全部标签
+	TagModeOr  = "or"  // 具有任一标签
+)
+
+// CustomerFilter 顾客筛选条件，用于顾客列表和保存的顾客分组
+// 消费金额为已确认单据金额减去退款，未就诊天数按最近一次已确认单据计算；条件为空表示不限
+// 顾客列表按标签名称筛选；保存的分组按标签ID存储（TagIDs），标签改名后分组不受影响，已删除的标签不再匹配任何顾客
+type CustomerFilter struct {
+	Tags             []string `json:"tags,omitempty"`
+	TagIDs           []uint   `json:"tag_ids,omitempty"`
+	TagMode          string   `json:"tag_mode,omitempty"`
+	CustomerTypes    []string `json:"customer_types,omitempty"`
+	ChannelID        *uint    `json:"channel_id,omitempty"`
+	SpendMin         *Money   `json:"spend_min,omitempty"`
+	SpendMax         *Money   `json:"spend_max,omitempty"`
+	LastVisitDaysMin *int     `json:"last_visit_days_min,omitempty"`
+	LastVisitDaysMax *int     `json:"last_visit_days_max,omitempty"`
+}
+
+// Value 以 JSON 存储
+func (f CustomerFilter) Value() (driver.Value, error) {
+	b, err := json.Marshal(f)
+	return string(b), err
+}
+
+// Scan 从 JSON 读取
+func (f *CustomerFilter) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*f = CustomerFilter{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, f)
+	case string:
+		return json.Unmarshal([]byte(v), f)
+	default:
+		return errors.New("无法解析顾客筛选条件")
+	}
+}
+
+// CustomerSegment 保存的顾客分组，按筛选条件实时查询顾客，供营销活动和回访名单复用
+type CustomerSegment struct {
+	ID          uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name        string         `gorm:"type:varchar(64);not null;uniqueIndex:uniq_name" json:"name"`
+	Description *string        `gorm:"type:varchar(255)" json:"description,omitempty"`
+	Filter      CustomerFilter `gorm:"type:text;not null" json:"filter"`
+	CreatedBy   *uint          `json:"created_by,omitempty"`
+	CreatedAt   *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt   *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+func (CustomerSegment) TableName() string {
+	return "customer_segments"
+}
@@ -5,14 +5,27 @@ import (
 	"gorm.io/gorm"
 )
 
+// Visit 就诊单据
+// 状态流转：draft（草稿）→ confirmed（已确认）→ voided（已作废）
+// 只有草稿可以修改明细；已确认的单据需由管理员撤回为草稿后才能修改
+// CustomerType 为就诊时顾客的分类（初诊/复诊/再消费），由顾客就诊记录自动计算
 type Visit struct {
 	ID            uint           `gorm:"primaryKey;autoIncrement" json:"id"`
 	VisitID       string         `gorm:"type:varchar(64);not null;uniqueIndex:uniq_visit_id" json:"visit_id"`
 	CustomerID    uint           `gorm:"not null;index:idx_customer_id" json:"customer_id"`
 	ConsultantID  *uint          `gorm:"index:idx_consultant_id" json:"consultant_id,omitempty"`
+	CustomerType  *string        `gorm:"type:varchar(20);index:idx_customer_type" json:"customer_type,omitempty"`
 	VisitDate     time.Time      `gorm:"not null;index:idx_visit_date" json:"visit_date"`
-	TotalAmount   float64        `gorm:"type:decimal(10,2);default:0" json:"total_amount"`
+	TotalAmount   Money          `gorm:"type:decimal(10,2);default:0" json:"total_amount"`
+	PaidAmount    Money          `gorm:"type:decimal(10,2);default:0" json:"paid_amount"`
+	PaymentStatus string         `gorm:"type:varchar(16);not null;default:unpaid;index:idx_payment_status" json:"payment_status"`
 	Remark        *string        `gorm:"type:text" json:"remark,omitempty"`
+	Status        string         `gorm:"type:varchar(16);not null;default:draft;index:idx_status" json:"status"`
+	ConfirmedAt   *time.Time     `json:"confirmed_at,omitempty"`
+	ConfirmedBy   *uint          `json:"confirmed_by,omitempty"`
+	VoidedAt      *time.Time     `json:"voided_at,omitempty"`
+	VoidedBy      *uint          `json:"voided_by,omitempty"`
+	VoidReason    *string        `gorm:"type:varchar(255)" json:"void_reason,omitempty"`
 	CreatedAt     *time.Time     `json:"created_at,omitempty"`
 	UpdatedAt     *time.Time     `json:"updated_at,omitempty"`
 	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
@@ -21,8 +34,29 @@ type Visit struct {
 	Customer   Customer   `gorm:"foreignKey:CustomerID" json:"customer,omitempty"`
 	Consultant *Employee  `gorm:"foreignKey:ConsultantID" json:"consultant,omitempty"`
 	Items      []VisitItem `gorm:"foreignKey:VisitID;references:ID" json:"items,omitempty"`
+	Payments   []Payment   `gorm:"foreignKey:VisitID" json:"payments,omitempty"`
 }
 
+// Visit status constants
+const (
+	VisitStatusDraft     = "draft"
+	VisitStatusConfirmed = "confirmed"
+	VisitStatusVoided    = "voided"
+)
+
 func (Visit) TableName() string {
 	return "visits"
 }
+
+// OutstandingAmount 未收金额
+func (v *Visit) OutstandingAmount() Money {
+	if v.PaidAmount >= v.TotalAmount {
+		return 0
+	}
+	return v.TotalAmount - v.PaidAmount
+}
+
+// Editable 是否允许修改单据及明细
+func (v *Visit) Editable() bool {
+	return v.Status == "" || v.Status == VisitStatusDraft
+}
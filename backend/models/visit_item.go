@@ -5,11 +5,24 @@ import (
 	"gorm.io/gorm"
 )
 
+// VisitItem 就诊明细
+// 参与人员及业绩以 Allocations 为准；CoDoctor1ID/CoDoctor2ID/Nurse1ID/Nurse2ID 等固定字段
+// 在过渡期内由分配记录回写，仅供旧接口读取。
+// PackageID 非空表示本条明细售卖疗程套餐；CustomerPackageID 非空表示本条明细消耗顾客已购疗程的一次。
+// 价格：ListPrice 为标价（项目标准价或套餐售价），DiscountType/DiscountAmount 记录优惠，Amount 为成交金额，
+// 低于标价的手工改价、折扣和立减需记录审批人 ApprovedByID。
 type VisitItem struct {
 	ID                    uint           `gorm:"primaryKey;autoIncrement" json:"id"`
 	VisitID               uint           `gorm:"not null;index:idx_visit_id" json:"visit_id"`
 	ProjectID             uint           `gorm:"not null;index:idx_project_id" json:"project_id"`
-	Amount                float64        `gorm:"type:decimal(10,2);not null" json:"amount"`
+	ListPrice             Money          `gorm:"type:decimal(10,2);default:0" json:"list_price"`
+	DiscountType          string         `gorm:"type:varchar(16);default:''" json:"discount_type,omitempty"`
+	DiscountRate          float64        `gorm:"type:decimal(5,4);default:0" json:"discount_rate,omitempty"`
+	DiscountAmount        Money          `gorm:"type:decimal(10,2);default:0" json:"discount_amount"`
+	CouponID              *uint          `gorm:"index:idx_coupon_id" json:"coupon_id,omitempty"`
+	CouponCode            *string        `gorm:"type:varchar(32)" json:"coupon_code,omitempty"`
+	ApprovedByID          *uint          `gorm:"index:idx_approved_by_id" json:"approved_by_id,omitempty"`
+	Amount                Money          `gorm:"type:decimal(10,2);not null" json:"amount"`
 	MainDoctorID          uint           `gorm:"not null;index:idx_main_doctor_id" json:"main_doctor_id"`
 	CoDoctor1ID           *uint          `gorm:"index:idx_co_doctor1_id" json:"co_doctor1_id,omitempty"`
 	CoRatio1              float64        `gorm:"type:decimal(3,2);default:0" json:"co_ratio1"`
@@ -17,11 +30,15 @@ type VisitItem struct {
 	CoRatio2              float64        `gorm:"type:decimal(3,2);default:0" json:"co_ratio2"`
 	Nurse1ID              *uint          `gorm:"index:idx_nurse1_id" json:"nurse1_id,omitempty"`
 	Nurse2ID              *uint          `gorm:"index:idx_nurse2_id" json:"nurse2_id,omitempty"`
-	MainDoctorPerformance float64        `gorm:"type:decimal(10,2);default:0" json:"main_doctor_performance"`
-	CoDoctor1Performance  float64        `gorm:"type:decimal(10,2);default:0" json:"co_doctor1_performance"`
-	CoDoctor2Performance  float64        `gorm:"type:decimal(10,2);default:0" json:"co_doctor2_performance"`
-	Nurse1Performance     float64        `gorm:"type:decimal(10,2);default:0" json:"nurse1_performance"`
-	Nurse2Performance     float64        `gorm:"type:decimal(10,2);default:0" json:"nurse2_performance"`
+	MainDoctorPerformance Money          `gorm:"type:decimal(10,2);default:0" json:"main_doctor_performance"`
+	CoDoctor1Performance  Money          `gorm:"type:decimal(10,2);default:0" json:"co_doctor1_performance"`
+	CoDoctor2Performance  Money          `gorm:"type:decimal(10,2);default:0" json:"co_doctor2_performance"`
+	Nurse1Performance     Money          `gorm:"type:decimal(10,2);default:0" json:"nurse1_performance"`
+	Nurse2Performance     Money          `gorm:"type:decimal(10,2);default:0" json:"nurse2_performance"`
+	CommissionPlanID      *uint          `gorm:"index:idx_commission_plan_id" json:"commission_plan_id,omitempty"`
+	PackageID             *uint          `gorm:"index:idx_package_id" json:"package_id,omitempty"`
+	CustomerPackageID     *uint          `gorm:"index:idx_customer_package_id" json:"customer_package_id,omitempty"`
+	PackageSessionNo      int            `gorm:"default:0" json:"package_session_no,omitempty"`
 	Remark                *string        `gorm:"type:text" json:"remark,omitempty"`
 	CreatedAt             *time.Time     `json:"created_at,omitempty"`
 	UpdatedAt             *time.Time     `json:"updated_at,omitempty"`
@@ -35,8 +52,23 @@ type VisitItem struct {
 	CoDoctor2    *Employee `gorm:"foreignKey:CoDoctor2ID" json:"co_doctor2,omitempty"`
 	Nurse1       *Employee `gorm:"foreignKey:Nurse1ID" json:"nurse1,omitempty"`
 	Nurse2       *Employee `gorm:"foreignKey:Nurse2ID" json:"nurse2,omitempty"`
+	CommissionPlan *CommissionPlan `gorm:"foreignKey:CommissionPlanID" json:"commission_plan,omitempty"`
+	Coupon         *Coupon         `gorm:"foreignKey:CouponID" json:"coupon,omitempty"`
+	ApprovedBy     *Employee       `gorm:"foreignKey:ApprovedByID" json:"approved_by,omitempty"`
+	Allocations  []VisitItemAllocation `gorm:"foreignKey:VisitItemID" json:"allocations,omitempty"`
+	Package         *Package         `gorm:"foreignKey:PackageID" json:"package,omitempty"`
+	CustomerPackage *CustomerPackage `gorm:"foreignKey:CustomerPackageID" json:"customer_package,omitempty"`
 }
 
+// Discount type constants
+const (
+	DiscountTypeNone       = ""           // 按标价成交
+	DiscountTypeManual     = "manual"     // 手工改价
+	DiscountTypePercentage = "percentage" // 折扣，DiscountRate 为成交比例（0.8 表示八折）
+	DiscountTypeFixed      = "fixed"      // 立减 DiscountAmount
+	DiscountTypeCoupon     = "coupon"     // 使用优惠券 CouponCode
+)
+
 func (VisitItem) TableName() string {
 	return "visit_items"
 }
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// VisitItemAllocation 就诊明细业绩分配
+// 每条记录对应明细的一位参与人员，支持任意数量的协同医生和护士。
+// RoleInItem 取值同提成角色（main_doctor/co_doctor/nurse），Ratio 为实际采用的分配比例。
+type VisitItemAllocation struct {
+	ID          uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	VisitItemID uint           `gorm:"not null;index:idx_visit_item_id" json:"visit_item_id"`
+	EmployeeID  uint           `gorm:"not null;index:idx_employee_id" json:"employee_id"`
+	RoleInItem  string         `gorm:"type:varchar(20);not null;index:idx_role_in_item" json:"role_in_item"`
+	Ratio       float64        `gorm:"type:decimal(5,4);default:0" json:"ratio"`
+	Performance Money          `gorm:"type:decimal(10,2);default:0" json:"performance"`
+	CreatedAt   *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt   *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Relationships
+	Employee *Employee `gorm:"foreignKey:EmployeeID" json:"employee,omitempty"`
+}
+
+func (VisitItemAllocation) TableName() string {
+	return "visit_item_allocations"
+}
+
+// LegacyAllocations 由明细上的固定参与人员字段生成分配记录，保留已保存的业绩
+func (item VisitItem) LegacyAllocations() []VisitItemAllocation {
+	allocations := []VisitItemAllocation{}
+	if item.MainDoctorID != 0 {
+		allocations = append(allocations, VisitItemAllocation{
+			VisitItemID: item.ID,
+			EmployeeID:  item.MainDoctorID,
+			RoleInItem:  CommissionRoleMainDoctor,
+			Ratio:       item.MainDoctorPerformance.Ratio(item.Amount),
+			Performance: item.MainDoctorPerformance,
+		})
+	}
+	if item.CoDoctor1ID != nil {
+		allocations = append(allocations, VisitItemAllocation{
+			VisitItemID: item.ID,
+			EmployeeID:  *item.CoDoctor1ID,
+			RoleInItem:  CommissionRoleCoDoctor,
+			Ratio:       item.CoRatio1,
+			Performance: item.CoDoctor1Performance,
+		})
+	}
+	if item.CoDoctor2ID != nil {
+		allocations = append(allocations, VisitItemAllocation{
+			VisitItemID: item.ID,
+			EmployeeID:  *item.CoDoctor2ID,
+			RoleInItem:  CommissionRoleCoDoctor,
+			Ratio:       item.CoRatio2,
+			Performance: item.CoDoctor2Performance,
+		})
+	}
+	if item.Nurse1ID != nil {
+		allocations = append(allocations, VisitItemAllocation{
+			VisitItemID: item.ID,
+			EmployeeID:  *item.Nurse1ID,
+			RoleInItem:  CommissionRoleNurse,
+			Ratio:       item.Nurse1Performance.Ratio(item.Amount),
+			Performance: item.Nurse1Performance,
+		})
+	}
+	if item.Nurse2ID != nil {
+		allocations = append(allocations, VisitItemAllocation{
+			VisitItemID: item.ID,
+			EmployeeID:  *item.Nurse2ID,
+			RoleInItem:  CommissionRoleNurse,
+			Ratio:       item.Nurse2Performance.Ratio(item.Amount),
+			Performance: item.Nurse2Performance,
+		})
+	}
+	return allocations
+}
+
+// SyncLegacyFields 将分配记录回写到明细的固定字段，供过渡期旧接口读取
+// 协同医生和护士只回写前两位，其余人员仅保存在分配记录中
+func (item *VisitItem) SyncLegacyFields() {
+	item.CoDoctor1ID, item.CoRatio1, item.CoDoctor1Performance = nil, 0, 0
+	item.CoDoctor2ID, item.CoRatio2, item.CoDoctor2Performance = nil, 0, 0
+	item.Nurse1ID, item.Nurse1Performance = nil, 0
+	item.Nurse2ID, item.Nurse2Performance = nil, 0
+	item.MainDoctorPerformance = 0
+
+	coCount, nurseCount := 0, 0
+	for i := range item.Allocations {
+		a := item.Allocations[i]
+		employeeID := a.EmployeeID
+		switch a.RoleInItem {
+		case CommissionRoleMainDoctor:
+			item.MainDoctorID = employeeID
+			item.MainDoctorPerformance = a.Performance
+		case CommissionRoleCoDoctor:
+			coCount++
+			if coCount == 1 {
+				item.CoDoctor1ID, item.CoRatio1, item.CoDoctor1Performance = &employeeID, a.Ratio, a.Performance
+			} else if coCount == 2 {
+				item.CoDoctor2ID, item.CoRatio2, item.CoDoctor2Performance = &employeeID, a.Ratio, a.Performance
+			}
+		case CommissionRoleNurse:
+			nurseCount++
+			if nurseCount == 1 {
+				item.Nurse1ID, item.Nurse1Performance = &employeeID, a.Performance
+			} else if nurseCount == 2 {
+				item.Nurse2ID, item.Nurse2Performance = &employeeID, a.Performance
+			}
+		}
+	}
+}
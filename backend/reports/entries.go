@@ -0,0 +1,90 @@
+package reports
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"skin-performance/models"
+)
+
+// PerformanceEntriesSQL 业绩流水：明细分配业绩（按就诊日期）与退款冲减业绩（按退款日期）合并
+// 所有业绩类报表统一基于该流水统计：只包含未删除的已确认单据、未删除的明细、未删除的分配记录和退款；
+// is_refund 为 1 的记录业绩为负数，refund_id 为对应的退款（分配业绩为0）。使用时需传入 EntriesParams 的命名参数，
+// 并在外层按 biz_date 过滤期间，例如：
+//
+//	SELECT ... FROM (` + reports.PerformanceEntriesSQL + `) p WHERE p.biz_date >= @from AND p.biz_date <= @to
+const PerformanceEntriesSQL = `
+	SELECT a.employee_id, a.visit_item_id, a.role_in_item, a.ratio, a.performance, v.visit_date AS biz_date, 0 AS is_refund, 0 AS refund_id
+	FROM visit_item_allocations a
+	JOIN visit_items vi ON vi.id = a.visit_item_id AND vi.deleted_at IS NULL
+	JOIN visits v ON v.id = vi.visit_id AND v.deleted_at IS NULL AND v.status = @status
+	WHERE a.deleted_at IS NULL
+	UNION ALL
+	SELECT ra.employee_id, ra.visit_item_id, ra.role_in_item, ra.ratio, ra.performance, r.refund_date AS biz_date, 1 AS is_refund, ra.refund_id
+	FROM refund_allocations ra
+	JOIN refunds r ON r.id = ra.refund_id AND r.deleted_at IS NULL
+	JOIN visit_items vi ON vi.id = ra.visit_item_id AND vi.deleted_at IS NULL
+	JOIN visits v ON v.id = vi.visit_id AND v.deleted_at IS NULL AND v.status = @status
+	WHERE ra.deleted_at IS NULL
+`
+
+// RevenueEntriesSQL 成交流水：明细金额（按就诊日期）与退款金额（按退款日期，记为负数）合并
+// customer_type 为就诊时的顾客分类；过滤规则、参数与用法同 PerformanceEntriesSQL
+const RevenueEntriesSQL = `
+	SELECT vi.id AS visit_item_id, vi.amount, v.visit_date AS biz_date, 0 AS is_refund, COALESCE(v.customer_type, '') AS customer_type
+	FROM visit_items vi
+	JOIN visits v ON v.id = vi.visit_id AND v.deleted_at IS NULL AND v.status = @status
+	WHERE vi.deleted_at IS NULL
+	UNION ALL
+	SELECT r.visit_item_id, -r.amount, r.refund_date AS biz_date, 1 AS is_refund, COALESCE(v.customer_type, '') AS customer_type
+	FROM refunds r
+	JOIN visit_items vi ON vi.id = r.visit_item_id AND vi.deleted_at IS NULL
+	JOIN visits v ON v.id = vi.visit_id AND v.deleted_at IS NULL AND v.status = @status
+	WHERE r.deleted_at IS NULL
+`
+
+// EntriesParams 流水查询的命名参数，dateTo 包含当天
+func EntriesParams(dateFrom, dateTo string) map[string]interface{} {
+	return map[string]interface{}{
+		"status": models.VisitStatusConfirmed,
+		"from":   dateFrom,
+		"to":     dateTo + " 23:59:59",
+	}
+}
+
+// PerformanceEntry 业绩流水中的一条记录
+type PerformanceEntry struct {
+	EmployeeID  uint
+	VisitItemID uint
+	RoleInItem  string
+	Ratio       float64
+	Performance models.Money
+	BizDate     time.Time
+	IsRefund    bool
+	RefundID    uint
+}
+
+// RevenueEntry 成交流水中的一条记录，退款记录的 Amount 为负数
+type RevenueEntry struct {
+	VisitItemID  uint
+	Amount       models.Money
+	BizDate      time.Time
+	IsRefund     bool
+	CustomerType string
+}
+
+// LoadPerformanceEntries 读取期间内的业绩流水
+func LoadPerformanceEntries(db *gorm.DB, p Period) ([]PerformanceEntry, error) {
+	var entries []PerformanceEntry
+	err := db.Raw(`SELECT * FROM (`+PerformanceEntriesSQL+`) en WHERE en.biz_date >= @from AND en.biz_date < @end ORDER BY en.biz_date`,
+		p.params()).Scan(&entries).Error
+	return entries, err
+}
+
+// LoadRevenueEntries 读取期间内的成交流水
+func LoadRevenueEntries(db *gorm.DB, p Period) ([]RevenueEntry, error) {
+	var entries []RevenueEntry
+	err := db.Raw(`SELECT * FROM (`+RevenueEntriesSQL+`) en WHERE en.biz_date >= @from AND en.biz_date < @end ORDER BY en.biz_date`,
+		p.params()).Scan(&entries).Error
+	return entries, err
+}
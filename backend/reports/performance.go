@@ -0,0 +1,204 @@
+// Package reports 报表查询层：业绩类报表统一基于业绩流水和成交流水统计
+// 流水从持久化的明细、业绩分配和退款冲减记录读取，汇总逻辑不依赖数据库，可直接用构造的流水测试
+package reports
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"skin-performance/models"
+)
+
+// Period 报表期间，按诊所时区的自然日划分，包含起止两天
+type Period struct {
+	From time.Time
+	To   time.Time
+}
+
+// NewPeriod 按诊所时区 loc 解析 YYYY-MM-DD 格式的起止日期
+func NewPeriod(dateFrom, dateTo string, loc *time.Location) (Period, error) {
+	from, err := time.ParseInLocation("2006-01-02", dateFrom, loc)
+	if err != nil {
+		return Period{}, errors.New("开始日期格式错误")
+	}
+	to, err := time.ParseInLocation("2006-01-02", dateTo, loc)
+	if err != nil {
+		return Period{}, errors.New("结束日期格式错误")
+	}
+	if to.Before(from) {
+		return Period{}, errors.New("结束日期不能早于开始日期")
+	}
+	return Period{From: from, To: to}, nil
+}
+
+// end 期间结束时间（不含），即结束日期的次日零点
+func (p Period) end() time.Time {
+	return p.To.AddDate(0, 0, 1)
+}
+
+// params 期间对应的流水查询命名参数，@end 为结束日期次日零点（不含）
+func (p Period) params() map[string]interface{} {
+	params := EntriesParams(p.From.Format("2006-01-02"), p.To.Format("2006-01-02"))
+	params["end"] = p.end()
+	return params
+}
+
+// Contains 时间是否在期间内
+func (p Period) Contains(t time.Time) bool {
+	return !t.Before(p.From) && t.Before(p.end())
+}
+
+// PerformanceDataset 业绩报表所需的持久化数据：期间内的业绩流水、成交流水及流水涉及的员工
+// 流水的过滤规则见 PerformanceEntriesSQL 和 RevenueEntriesSQL
+type PerformanceDataset struct {
+	Employees   []models.Employee
+	Performance []PerformanceEntry
+	Revenue     []RevenueEntry
+}
+
+// EmployeePerformance 员工期间业绩
+// 各角色业绩及 TotalPerformance 为扣除退款后的净业绩；
+// GrossPerformance 为期间内已确认单据的业绩，RefundedPerformance 为期间内退款冲减的业绩（负数）
+type EmployeePerformance struct {
+	EmployeeID            uint         `json:"employee_id"`
+	EmployeeName          string       `json:"employee_name"`
+	EmployeeRole          string       `json:"employee_role"`
+	MainPerformance       models.Money `json:"main_performance"`
+	CoPerformance         models.Money `json:"co_performance"`
+	NursePerformance      models.Money `json:"nurse_performance"`
+	ConsultantPerformance models.Money `json:"consultant_performance"`
+	GrossPerformance      models.Money `json:"gross_performance"`
+	RefundedPerformance   models.Money `json:"refunded_performance"`
+	NetPerformance        models.Money `json:"net_performance"`
+	TotalPerformance      models.Money `json:"total_performance"`
+}
+
+func (e *EmployeePerformance) add(roleInItem string, performance models.Money, refund bool) {
+	switch roleInItem {
+	case models.CommissionRoleMainDoctor:
+		e.MainPerformance += performance
+	case models.CommissionRoleCoDoctor:
+		e.CoPerformance += performance
+	case models.CommissionRoleNurse:
+		e.NursePerformance += performance
+	case models.CommissionRoleConsultant:
+		e.ConsultantPerformance += performance
+	}
+	if refund {
+		e.RefundedPerformance += performance
+	} else {
+		e.GrossPerformance += performance
+	}
+	e.NetPerformance = e.GrossPerformance + e.RefundedPerformance
+	e.TotalPerformance = e.NetPerformance
+}
+
+// PerformanceReport 业绩报表
+// TotalAmount 为期间内已确认单据的明细金额，RefundedAmount 为期间内的退款冲减（负数，与 RefundedPerformance 同号），
+// NetAmount = TotalAmount + RefundedAmount；
+// AmountByCustomerType 按就诊时的顾客分类拆分 TotalAmount
+type PerformanceReport struct {
+	TotalAmount          models.Money
+	RefundedAmount       models.Money
+	NetAmount            models.Money
+	AmountByCustomerType map[string]models.Money
+	// TotalPerformance 报表中各员工净业绩之和
+	TotalPerformance models.Money
+	Employees        []EmployeePerformance
+}
+
+// NewCustomerAmount 初诊顾客的成交金额
+func (r PerformanceReport) NewCustomerAmount() models.Money {
+	return r.AmountByCustomerType[models.CustomerTypeNew]
+}
+
+// ReturningCustomerAmount 复诊和再消费顾客的成交金额
+func (r PerformanceReport) ReturningCustomerAmount() models.Money {
+	return r.AmountByCustomerType[models.CustomerTypeReturn] + r.AmountByCustomerType[models.CustomerTypeRepeat]
+}
+
+// LoadPerformanceDataset 读取期间内业绩报表所需的数据
+func LoadPerformanceDataset(db *gorm.DB, p Period) (PerformanceDataset, error) {
+	var ds PerformanceDataset
+	var err error
+	if ds.Performance, err = LoadPerformanceEntries(db, p); err != nil {
+		return ds, err
+	}
+	if ds.Revenue, err = LoadRevenueEntries(db, p); err != nil {
+		return ds, err
+	}
+
+	employeeIDs := make(map[uint]bool)
+	for _, en := range ds.Performance {
+		employeeIDs[en.EmployeeID] = true
+	}
+	if len(employeeIDs) > 0 {
+		ids := make([]uint, 0, len(employeeIDs))
+		for id := range employeeIDs {
+			ids = append(ids, id)
+		}
+		if err := db.Where("id IN ?", ids).Find(&ds.Employees).Error; err != nil {
+			return ds, err
+		}
+	}
+	return ds, nil
+}
+
+// BuildPerformanceReport 汇总业绩报表
+// 业绩取分配记录中按提成规则计算并保存的结果；单据业绩按就诊日期计入期间，
+// 退款冲减按退款日期计入期间，期间外的流水忽略；只列出在职员工
+func BuildPerformanceReport(ds PerformanceDataset, p Period) PerformanceReport {
+	report := PerformanceReport{
+		AmountByCustomerType: make(map[string]models.Money),
+		Employees:            []EmployeePerformance{},
+	}
+
+	for _, en := range ds.Revenue {
+		if !p.Contains(en.BizDate) {
+			continue
+		}
+		if en.IsRefund {
+			report.RefundedAmount += en.Amount
+			continue
+		}
+		report.TotalAmount += en.Amount
+		report.AmountByCustomerType[en.CustomerType] += en.Amount
+	}
+
+	employees := make(map[uint]models.Employee, len(ds.Employees))
+	for _, e := range ds.Employees {
+		if !e.DeletedAt.Valid && e.IsActive {
+			employees[e.ID] = e
+		}
+	}
+	rows := make(map[uint]*EmployeePerformance)
+	for _, en := range ds.Performance {
+		e, ok := employees[en.EmployeeID]
+		if !ok || !p.Contains(en.BizDate) {
+			continue
+		}
+		if rows[e.ID] == nil {
+			rows[e.ID] = &EmployeePerformance{EmployeeID: e.ID, EmployeeName: e.Name, EmployeeRole: e.Role}
+		}
+		rows[e.ID].add(en.RoleInItem, en.Performance, en.IsRefund)
+	}
+
+	for _, r := range rows {
+		if r.GrossPerformance == 0 && r.RefundedPerformance == 0 {
+			continue
+		}
+		report.Employees = append(report.Employees, *r)
+		report.TotalPerformance += r.TotalPerformance
+	}
+	sort.Slice(report.Employees, func(i, j int) bool {
+		a, b := report.Employees[i], report.Employees[j]
+		if a.NetPerformance != b.NetPerformance {
+			return a.NetPerformance > b.NetPerformance
+		}
+		return a.EmployeeID < b.EmployeeID
+	})
+	report.NetAmount = report.TotalAmount + report.RefundedAmount
+	return report
+}
@@ -0,0 +1,362 @@
+package reports
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"skin-performance/models"
+)
+
+func yuan(v float64) models.Money {
+	return models.NewMoneyFromFloat(v)
+}
+
+func at(s string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func marchPeriod(t *testing.T) Period {
+	t.Helper()
+	p, err := NewPeriod("2026-03-01", "2026-03-31", time.Local)
+	if err != nil {
+		t.Fatalf("NewPeriod: %v", err)
+	}
+	return p
+}
+
+// marchStaff 测试员工：医生A、医生B、护士C、咨询师D 在职，另有停用医生和已删除护士
+type marchStaff struct {
+	doctorA, doctorB, nurse, consultant, inactive, deleted uint
+}
+
+// checkMarchReport 核对2026年3月的业绩报表
+// 数据覆盖软删除、草稿、期间外单据、跨期退款和停用员工，内存数据集和数据库数据集应得到相同的结果
+func checkMarchReport(t *testing.T, staff marchStaff, report PerformanceReport) {
+	t.Helper()
+
+	want := []EmployeePerformance{
+		{EmployeeID: staff.doctorA, MainPerformance: yuan(1300), GrossPerformance: yuan(1300), TotalPerformance: yuan(1300)},
+		{EmployeeID: staff.doctorB, MainPerformance: yuan(-100), CoPerformance: yuan(200), GrossPerformance: yuan(200), RefundedPerformance: yuan(-100), TotalPerformance: yuan(100)},
+		{EmployeeID: staff.nurse, NursePerformance: yuan(50), GrossPerformance: yuan(50), TotalPerformance: yuan(50)},
+		{EmployeeID: staff.consultant, ConsultantPerformance: yuan(30), GrossPerformance: yuan(30), TotalPerformance: yuan(30)},
+	}
+	if len(report.Employees) != len(want) {
+		t.Fatalf("报表人数 = %d, 期望 %d: %+v", len(report.Employees), len(want), report.Employees)
+	}
+	var sum models.Money
+	for i, row := range report.Employees {
+		w := want[i]
+		if row.EmployeeID != w.EmployeeID {
+			t.Errorf("第%d行为 %s，应按净业绩从高到低排序", i+1, row.EmployeeName)
+			continue
+		}
+		if row.MainPerformance != w.MainPerformance || row.CoPerformance != w.CoPerformance ||
+			row.NursePerformance != w.NursePerformance || row.ConsultantPerformance != w.ConsultantPerformance ||
+			row.GrossPerformance != w.GrossPerformance || row.RefundedPerformance != w.RefundedPerformance ||
+			row.TotalPerformance != w.TotalPerformance {
+			t.Errorf("%s = %+v, 期望 %+v", row.EmployeeName, row, w)
+		}
+		if row.GrossPerformance+row.RefundedPerformance != row.NetPerformance {
+			t.Errorf("%s 毛业绩 %s + 退款冲减 %s != 净业绩 %s", row.EmployeeName, row.GrossPerformance, row.RefundedPerformance, row.NetPerformance)
+		}
+		sum += row.TotalPerformance
+	}
+	if report.TotalPerformance != yuan(1480) || sum != report.TotalPerformance {
+		t.Errorf("报表总业绩 = %s, 各行之和 = %s, 期望 1480.00", report.TotalPerformance, sum)
+	}
+
+	if report.TotalAmount != yuan(1700) {
+		t.Errorf("总金额 = %s, 期望 1700.00", report.TotalAmount)
+	}
+	if report.RefundedAmount != yuan(-100) {
+		t.Errorf("退款冲减 = %s, 期望 -100.00", report.RefundedAmount)
+	}
+	if report.NetAmount != yuan(1600) {
+		t.Errorf("净金额 = %s, 期望 1600.00", report.NetAmount)
+	}
+	if got := report.NewCustomerAmount(); got != yuan(1200) {
+		t.Errorf("初诊金额 = %s, 期望 1200.00", got)
+	}
+	if got := report.ReturningCustomerAmount(); got != yuan(500) {
+		t.Errorf("老客金额 = %s, 期望 500.00", got)
+	}
+}
+
+// marchDataset 流水查询返回的2026年3月前后的数据，软删除和草稿单据的记录已由查询排除
+func marchDataset() (PerformanceDataset, marchStaff) {
+	staff := marchStaff{doctorA: 1, doctorB: 2, nurse: 3, consultant: 4, inactive: 5, deleted: 6}
+	ds := PerformanceDataset{
+		Employees: []models.Employee{
+			{ID: staff.doctorA, Name: "医生A", Role: models.RoleDoctor, IsActive: true},
+			{ID: staff.doctorB, Name: "医生B", Role: models.RoleDoctor, IsActive: true},
+			{ID: staff.nurse, Name: "护士C", Role: models.RoleNurse, IsActive: true},
+			{ID: staff.consultant, Name: "咨询师D", Role: models.RoleConsultant, IsActive: true},
+			{ID: staff.inactive, Name: "停用医生", Role: models.RoleDoctor},
+			{ID: staff.deleted, Name: "已删除护士", Role: models.RoleNurse, IsActive: true,
+				DeletedAt: gorm.DeletedAt{Time: at("2026-03-20 10:00"), Valid: true}},
+		},
+	}
+	perf := func(employeeID, itemID uint, role string, performance float64, date string, refundID uint) {
+		ds.Performance = append(ds.Performance, PerformanceEntry{
+			EmployeeID: employeeID, VisitItemID: itemID, RoleInItem: role, Performance: yuan(performance),
+			BizDate: at(date), IsRefund: refundID != 0, RefundID: refundID,
+		})
+	}
+	revenue := func(itemID uint, amount float64, date, customerType string, refund bool) {
+		ds.Revenue = append(ds.Revenue, RevenueEntry{
+			VisitItemID: itemID, Amount: yuan(amount), BizDate: at(date), IsRefund: refund, CustomerType: customerType,
+		})
+	}
+
+	// 初诊单据：主操业绩为扣除协同后的保存值，而非明细金额；停用和已删除员工的业绩不列入报表
+	revenue(1, 1000, "2026-03-05 10:00", models.CustomerTypeNew, false)
+	perf(staff.doctorA, 1, models.CommissionRoleMainDoctor, 800, "2026-03-05 10:00", 0)
+	perf(staff.doctorB, 1, models.CommissionRoleCoDoctor, 200, "2026-03-05 10:00", 0)
+	perf(staff.nurse, 1, models.CommissionRoleNurse, 50, "2026-03-05 10:00", 0)
+	perf(staff.consultant, 1, models.CommissionRoleConsultant, 30, "2026-03-05 10:00", 0)
+	revenue(2, 200, "2026-03-05 10:00", models.CustomerTypeNew, false)
+	perf(staff.inactive, 2, models.CommissionRoleMainDoctor, 200, "2026-03-05 10:00", 0)
+	perf(staff.deleted, 2, models.CommissionRoleNurse, 10, "2026-03-05 10:00", 0)
+	// 期间结束后的退款不计入
+	revenue(1, -50, "2026-04-02 09:00", models.CustomerTypeNew, true)
+	perf(staff.doctorA, 1, models.CommissionRoleMainDoctor, -40, "2026-04-02 09:00", 1)
+
+	// 复诊单据
+	revenue(3, 500, "2026-03-31 23:30", models.CustomerTypeReturn, false)
+	perf(staff.doctorA, 3, models.CommissionRoleMainDoctor, 500, "2026-03-31 23:30", 0)
+
+	// 期间前的单据不计入，但其在期间内的退款冲减计入退款日期
+	revenue(4, 700, "2026-02-20 14:00", models.CustomerTypeRepeat, false)
+	perf(staff.doctorB, 4, models.CommissionRoleMainDoctor, 700, "2026-02-20 14:00", 0)
+	revenue(4, -100, "2026-03-08 16:00", models.CustomerTypeRepeat, true)
+	perf(staff.doctorB, 4, models.CommissionRoleMainDoctor, -100, "2026-03-08 16:00", 2)
+
+	// 期间后的单据不计入
+	revenue(5, 900, "2026-04-01 00:00", models.CustomerTypeNew, false)
+	perf(staff.doctorA, 5, models.CommissionRoleMainDoctor, 900, "2026-04-01 00:00", 0)
+
+	return ds, staff
+}
+
+func TestBuildPerformanceReport(t *testing.T) {
+	ds, staff := marchDataset()
+	checkMarchReport(t, staff, BuildPerformanceReport(ds, marchPeriod(t)))
+}
+
+func TestBuildPerformanceReportEmptyDataset(t *testing.T) {
+	report := BuildPerformanceReport(PerformanceDataset{}, marchPeriod(t))
+	if report.Employees == nil || len(report.Employees) != 0 {
+		t.Errorf("空数据集应返回空列表，得到 %v", report.Employees)
+	}
+	if report.TotalAmount != 0 || report.TotalPerformance != 0 {
+		t.Errorf("空数据集合计应为0，得到金额 %s 业绩 %s", report.TotalAmount, report.TotalPerformance)
+	}
+}
+
+func TestNewPeriod(t *testing.T) {
+	p := marchPeriod(t)
+	cases := []struct {
+		at   string
+		want bool
+	}{
+		{"2026-02-28 23:59", false},
+		{"2026-03-01 00:00", true},
+		{"2026-03-31 23:59", true},
+		{"2026-04-01 00:00", false},
+	}
+	for _, c := range cases {
+		if got := p.Contains(at(c.at)); got != c.want {
+			t.Errorf("Contains(%s) = %v, 期望 %v", c.at, got, c.want)
+		}
+	}
+
+	// 期间按传入的诊所时区划分，与服务器时区无关
+	utc8 := time.FixedZone("UTC+8", 8*3600)
+	day, err := NewPeriod("2026-03-01", "2026-03-01", utc8)
+	if err != nil {
+		t.Fatalf("NewPeriod: %v", err)
+	}
+	for _, c := range []struct {
+		at   time.Time
+		want bool
+	}{
+		{time.Date(2026, 2, 28, 15, 59, 0, 0, time.UTC), false},
+		{time.Date(2026, 2, 28, 16, 0, 0, 0, time.UTC), true},
+		{time.Date(2026, 3, 1, 15, 59, 0, 0, time.UTC), true},
+		{time.Date(2026, 3, 1, 16, 0, 0, 0, time.UTC), false},
+	} {
+		if got := day.Contains(c.at); got != c.want {
+			t.Errorf("Contains(%s) = %v, 期望 %v", c.at, got, c.want)
+		}
+	}
+
+	for _, bad := range [][2]string{{"2026/03/01", "2026-03-31"}, {"2026-03-01", "31"}, {"2026-03-31", "2026-03-01"}} {
+		if _, err := NewPeriod(bad[0], bad[1], time.Local); err == nil {
+			t.Errorf("NewPeriod(%s, %s) 应返回错误", bad[0], bad[1])
+		}
+	}
+}
+
+// testDB 连接 TEST_MYSQL_DSN 指定的测试库（应为专用的空库），未设置时跳过
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("未设置 TEST_MYSQL_DSN，跳过数据库测试")
+	}
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{
+		Logger:                                   logger.Default.LogMode(logger.Silent),
+		DisableForeignKeyConstraintWhenMigrating: true,
+	})
+	if err != nil {
+		t.Fatalf("连接测试库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Employee{}, &models.Visit{}, &models.VisitItem{},
+		&models.VisitItemAllocation{}, &models.Refund{}, &models.RefundAllocation{}); err != nil {
+		t.Fatalf("迁移测试库失败: %v", err)
+	}
+	return db
+}
+
+// marchSeeder 在测试库中写入与 marchDataset 对应的原始记录，额外包含应由流水查询排除的软删除和草稿记录
+type marchSeeder struct {
+	t       *testing.T
+	tx      *gorm.DB
+	visitNo int
+}
+
+func (s *marchSeeder) create(value interface{}, deleted bool) {
+	s.t.Helper()
+	if err := s.tx.Omit(clause.Associations).Create(value).Error; err != nil {
+		s.t.Fatalf("写入测试数据失败: %v", err)
+	}
+	if deleted {
+		if err := s.tx.Delete(value).Error; err != nil {
+			s.t.Fatalf("删除测试数据失败: %v", err)
+		}
+	}
+}
+
+func (s *marchSeeder) employee(name, role string, active, deleted bool) uint {
+	e := models.Employee{Name: name, Role: role, IsActive: true}
+	s.create(&e, deleted)
+	if !active {
+		// IsActive 的数据库默认值为 true，零值不会写入
+		if err := s.tx.Model(&e).Update("is_active", false).Error; err != nil {
+			s.t.Fatalf("停用员工失败: %v", err)
+		}
+	}
+	return e.ID
+}
+
+func (s *marchSeeder) visit(date, status, customerType string, deleted bool) models.Visit {
+	s.visitNo++
+	v := models.Visit{VisitID: fmt.Sprintf("TEST-%d", s.visitNo), CustomerID: 1, VisitDate: at(date), Status: status, CustomerType: &customerType}
+	s.create(&v, deleted)
+	return v
+}
+
+func (s *marchSeeder) item(v models.Visit, amount float64, deleted bool) models.VisitItem {
+	item := models.VisitItem{VisitID: v.ID, ProjectID: 1, Amount: yuan(amount)}
+	s.create(&item, deleted)
+	return item
+}
+
+func (s *marchSeeder) allocation(item models.VisitItem, employeeID uint, role string, performance float64, deleted bool) {
+	s.create(&models.VisitItemAllocation{VisitItemID: item.ID, EmployeeID: employeeID, RoleInItem: role, Performance: yuan(performance)}, deleted)
+}
+
+func (s *marchSeeder) refund(item models.VisitItem, date string, amount float64, deleted bool) models.Refund {
+	r := models.Refund{VisitItemID: item.ID, Amount: yuan(amount), RefundDate: at(date)}
+	s.create(&r, deleted)
+	return r
+}
+
+func (s *marchSeeder) refundAllocation(r models.Refund, employeeID uint, role string, performance float64) {
+	s.create(&models.RefundAllocation{RefundID: r.ID, VisitItemID: r.VisitItemID, EmployeeID: employeeID, RoleInItem: role, Performance: yuan(performance)}, false)
+}
+
+func TestLoadPerformanceDataset(t *testing.T) {
+	db := testDB(t)
+	tx := db.Begin()
+	defer tx.Rollback()
+
+	s := &marchSeeder{t: t, tx: tx}
+	staff := marchStaff{
+		doctorA:    s.employee("医生A", models.RoleDoctor, true, false),
+		doctorB:    s.employee("医生B", models.RoleDoctor, true, false),
+		nurse:      s.employee("护士C", models.RoleNurse, true, false),
+		consultant: s.employee("咨询师D", models.RoleConsultant, true, false),
+		inactive:   s.employee("停用医生", models.RoleDoctor, false, false),
+		deleted:    s.employee("已删除护士", models.RoleNurse, true, true),
+	}
+	confirmed := models.VisitStatusConfirmed
+
+	v1 := s.visit("2026-03-05 10:00", confirmed, models.CustomerTypeNew, false)
+	i1 := s.item(v1, 1000, false)
+	s.allocation(i1, staff.doctorA, models.CommissionRoleMainDoctor, 800, false)
+	s.allocation(i1, staff.doctorB, models.CommissionRoleCoDoctor, 200, false)
+	s.allocation(i1, staff.nurse, models.CommissionRoleNurse, 50, false)
+	s.allocation(i1, staff.consultant, models.CommissionRoleConsultant, 30, false)
+	i2 := s.item(v1, 200, false)
+	s.allocation(i2, staff.inactive, models.CommissionRoleMainDoctor, 200, false)
+	s.allocation(i2, staff.deleted, models.CommissionRoleNurse, 10, false)
+	r1 := s.refund(i1, "2026-04-02 09:00", 50, false)
+	s.refundAllocation(r1, staff.doctorA, models.CommissionRoleMainDoctor, -40)
+
+	// 已删除的明细、已删除的分配记录和已删除的退款不计入
+	v2 := s.visit("2026-03-31 23:30", confirmed, models.CustomerTypeReturn, false)
+	i3 := s.item(v2, 500, false)
+	s.allocation(i3, staff.doctorA, models.CommissionRoleMainDoctor, 500, false)
+	s.allocation(i3, staff.nurse, models.CommissionRoleNurse, 25, true)
+	deletedItem := s.item(v2, 300, true)
+	s.allocation(deletedItem, staff.doctorB, models.CommissionRoleMainDoctor, 300, false)
+	deletedRefund := s.refund(i3, "2026-03-09 15:00", 100, true)
+	s.refundAllocation(deletedRefund, staff.doctorA, models.CommissionRoleMainDoctor, -100)
+
+	// 已删除的单据、草稿单据和作废单据不计入
+	for _, v := range []models.Visit{
+		s.visit("2026-03-12 11:00", confirmed, models.CustomerTypeReturn, true),
+		s.visit("2026-03-15 11:00", models.VisitStatusDraft, models.CustomerTypeReturn, false),
+		s.visit("2026-03-16 11:00", models.VisitStatusVoided, models.CustomerTypeReturn, false),
+	} {
+		item := s.item(v, 600, false)
+		s.allocation(item, staff.doctorB, models.CommissionRoleMainDoctor, 600, false)
+		r := s.refund(item, "2026-03-20 10:00", 100, false)
+		s.refundAllocation(r, staff.doctorB, models.CommissionRoleMainDoctor, -100)
+	}
+
+	v4 := s.visit("2026-02-20 14:00", confirmed, models.CustomerTypeRepeat, false)
+	i4 := s.item(v4, 700, false)
+	s.allocation(i4, staff.doctorB, models.CommissionRoleMainDoctor, 700, false)
+	r2 := s.refund(i4, "2026-03-08 16:00", 100, false)
+	s.refundAllocation(r2, staff.doctorB, models.CommissionRoleMainDoctor, -100)
+
+	v5 := s.visit("2026-04-01 00:00", confirmed, models.CustomerTypeNew, false)
+	i5 := s.item(v5, 900, false)
+	s.allocation(i5, staff.doctorA, models.CommissionRoleMainDoctor, 900, false)
+
+	p := marchPeriod(t)
+	ds, err := LoadPerformanceDataset(tx, p)
+	if err != nil {
+		t.Fatalf("LoadPerformanceDataset: %v", err)
+	}
+	// 期间内的流水：明细1的4条和明细2的2条分配、明细3的1条分配、期间前单据的1条退款冲减
+	if len(ds.Performance) != 8 {
+		t.Errorf("业绩流水 %d 条, 期望 8 条: %+v", len(ds.Performance), ds.Performance)
+	}
+	if len(ds.Revenue) != 4 {
+		t.Errorf("成交流水 %d 条, 期望 4 条: %+v", len(ds.Revenue), ds.Revenue)
+	}
+	checkMarchReport(t, staff, BuildPerformanceReport(ds, p))
+}
@@ -25,9 +25,23 @@ func SetupRoutes(r *gin.Engine) {
 		// 顾客管理
 		auth.GET("/customers", controllers.ListCustomers)
 		auth.GET("/customers/:id", controllers.GetCustomer)
+		auth.GET("/customers/:id/timeline", controllers.GetCustomerTimeline)
+		auth.GET("/customers/:id/phone", controllers.RevealCustomerPhone)
+		auth.GET("/customers/duplicates", controllers.FindDuplicateCustomers)
+		auth.GET("/customers/rfm", controllers.ListCustomerRFM)
+		auth.POST("/customers/:id/merge", middleware.AdminMiddleware(), controllers.MergeCustomers)
+		auth.GET("/customer-merge-logs", middleware.AdminMiddleware(), controllers.ListCustomerMergeLogs)
+		auth.GET("/contact-access-logs", middleware.AdminMiddleware(), controllers.ListContactAccessLogs)
 		auth.POST("/customers", controllers.CreateCustomer)
 		auth.PUT("/customers/:id", controllers.UpdateCustomer)
 		auth.DELETE("/customers/:id", controllers.DeleteCustomer)
+		auth.PUT("/customers/:id/tags", controllers.SetCustomerTags)
+
+		// 储值账户（退卡需管理员权限）
+		auth.GET("/customers/:id/stored-value", controllers.GetStoredValueAccount)
+		auth.GET("/customers/:id/stored-value/transactions", controllers.ListStoredValueTransactions)
+		auth.POST("/customers/:id/stored-value/top-up", controllers.TopUpStoredValue)
+		auth.POST("/customers/:id/stored-value/refund", middleware.AdminMiddleware(), controllers.RefundStoredValue)
 
 		// 员工管理（仅管理员可修改）
 		auth.GET("/employees", controllers.ListEmployees)
@@ -43,12 +57,57 @@ func SetupRoutes(r *gin.Engine) {
 		auth.PUT("/projects/:id", middleware.AdminMiddleware(), controllers.UpdateProject)
 		auth.DELETE("/projects/:id", middleware.AdminMiddleware(), controllers.DeleteProject)
 
+		// 疗程套餐（仅管理员可修改）及顾客已购疗程
+		auth.GET("/packages", controllers.ListPackages)
+		auth.GET("/packages/:id", controllers.GetPackage)
+		auth.POST("/packages", middleware.AdminMiddleware(), controllers.CreatePackage)
+		auth.PUT("/packages/:id", middleware.AdminMiddleware(), controllers.UpdatePackage)
+		auth.DELETE("/packages/:id", middleware.AdminMiddleware(), controllers.DeletePackage)
+		auth.GET("/customer-packages", controllers.ListCustomerPackages)
+		auth.GET("/customer-packages/:id", controllers.GetCustomerPackage)
+
+		// 来源渠道字典（仅管理员可修改）
+		auth.GET("/channels", controllers.ListChannels)
+		auth.POST("/channels", middleware.AdminMiddleware(), controllers.CreateChannel)
+		auth.PUT("/channels/:id", middleware.AdminMiddleware(), controllers.UpdateChannel)
+		auth.DELETE("/channels/:id", middleware.AdminMiddleware(), controllers.DeleteChannel)
+
+		// 顾客标签（修改和删除需管理员权限）及保存的顾客分组
+		auth.GET("/tags", controllers.ListTags)
+		auth.POST("/tags", controllers.CreateTag)
+		auth.PUT("/tags/:id", middleware.AdminMiddleware(), controllers.UpdateTag)
+		auth.DELETE("/tags/:id", middleware.AdminMiddleware(), controllers.DeleteTag)
+		auth.GET("/customer-segments", controllers.ListCustomerSegments)
+		auth.GET("/customer-segments/:id", controllers.GetCustomerSegment)
+		auth.POST("/customer-segments", controllers.CreateCustomerSegment)
+		auth.PUT("/customer-segments/:id", controllers.UpdateCustomerSegment)
+		auth.DELETE("/customer-segments/:id", controllers.DeleteCustomerSegment)
+
+		// 顾客分群定义（仅管理员可修改）
+		auth.GET("/rfm-segments", controllers.ListRFMSegments)
+		auth.POST("/rfm-segments", middleware.AdminMiddleware(), controllers.CreateRFMSegment)
+		auth.PUT("/rfm-segments/:id", middleware.AdminMiddleware(), controllers.UpdateRFMSegment)
+		auth.DELETE("/rfm-segments/:id", middleware.AdminMiddleware(), controllers.DeleteRFMSegment)
+
+		// 优惠券（仅管理员可修改）
+		auth.GET("/coupons", controllers.ListCoupons)
+		auth.GET("/coupons/:id", controllers.GetCoupon)
+		auth.POST("/coupons", middleware.AdminMiddleware(), controllers.CreateCoupon)
+		auth.PUT("/coupons/:id", middleware.AdminMiddleware(), controllers.UpdateCoupon)
+		auth.DELETE("/coupons/:id", middleware.AdminMiddleware(), controllers.DeleteCoupon)
+
 		// 就诊管理
 		auth.GET("/visits", controllers.ListVisits)
 		auth.GET("/visits/:id", controllers.GetVisit)
 		auth.POST("/visits", controllers.CreateVisit)
 		auth.PUT("/visits/:id", controllers.UpdateVisit)
 		auth.DELETE("/visits/:id", controllers.DeleteVisit)
+		auth.POST("/visits/:id/confirm", controllers.ConfirmVisit)
+		auth.POST("/visits/:id/void", controllers.VoidVisit)
+		auth.POST("/visits/:id/reopen", middleware.AdminMiddleware(), controllers.ReopenVisit)
+		auth.GET("/visits/:id/payments", controllers.ListVisitPayments)
+		auth.POST("/visits/:id/payments", controllers.CreateVisitPayment)
+		auth.DELETE("/visits/:id/payments/:payment_id", middleware.AdminMiddleware(), controllers.DeleteVisitPayment)
 
 		// 就诊明细
 		auth.GET("/visit-items", controllers.ListVisitItems)
@@ -57,6 +116,12 @@ func SetupRoutes(r *gin.Engine) {
 		auth.PUT("/visit-items/:id", controllers.UpdateVisitItem)
 		auth.DELETE("/visit-items/:id", controllers.DeleteVisitItem)
 
+		// 退款（删除需管理员权限）
+		auth.GET("/refunds", controllers.ListRefunds)
+		auth.GET("/refunds/:id", controllers.GetRefund)
+		auth.POST("/refunds", controllers.CreateRefund)
+		auth.DELETE("/refunds/:id", middleware.AdminMiddleware(), controllers.DeleteRefund)
+
 		// 回访记录
 		auth.GET("/revisit-records", controllers.ListRevisitRecords)
 		auth.GET("/revisit-records/:id", controllers.GetRevisitRecord)
@@ -64,9 +129,40 @@ func SetupRoutes(r *gin.Engine) {
 		auth.PUT("/revisit-records/:id", controllers.UpdateRevisitRecord)
 		auth.DELETE("/revisit-records/:id", controllers.DeleteRevisitRecord)
 
+		// 提成规则（仅管理员可修改）
+		auth.GET("/commission-rules", controllers.ListCommissionRules)
+		auth.GET("/commission-rules/:id", controllers.GetCommissionRule)
+		auth.POST("/commission-rules", middleware.AdminMiddleware(), controllers.CreateCommissionRule)
+		auth.PUT("/commission-rules/:id", middleware.AdminMiddleware(), controllers.UpdateCommissionRule)
+		auth.DELETE("/commission-rules/:id", middleware.AdminMiddleware(), controllers.DeleteCommissionRule)
+
+		// 提成方案版本（仅管理员可修改）
+		auth.GET("/commission-plans", controllers.ListCommissionPlans)
+		auth.GET("/commission-plans/:id", controllers.GetCommissionPlan)
+		auth.POST("/commission-plans", middleware.AdminMiddleware(), controllers.CreateCommissionPlan)
+		auth.PUT("/commission-plans/:id", middleware.AdminMiddleware(), controllers.UpdateCommissionPlan)
+		auth.DELETE("/commission-plans/:id", middleware.AdminMiddleware(), controllers.DeleteCommissionPlan)
+		auth.POST("/commission-plans/:id/recalculate", middleware.AdminMiddleware(), controllers.RecalculateCommissionPlan)
+
+		// 阶梯提成档位（仅管理员可修改）
+		auth.GET("/commission-tiers", controllers.ListCommissionTiers)
+		auth.POST("/commission-tiers", middleware.AdminMiddleware(), controllers.CreateCommissionTier)
+		auth.PUT("/commission-tiers/:id", middleware.AdminMiddleware(), controllers.UpdateCommissionTier)
+		auth.DELETE("/commission-tiers/:id", middleware.AdminMiddleware(), controllers.DeleteCommissionTier)
+
+		// 月度结算（仅管理员可结算）
+		auth.GET("/settlements", controllers.ListSettlements)
+		auth.POST("/settlements", middleware.AdminMiddleware(), controllers.CreateSettlements)
+
 		// 报表统计
 		auth.GET("/reports/performance", controllers.GetPerformanceReport)
 		auth.GET("/reports/employee-performance", controllers.GetEmployeePerformance)
 		auth.GET("/reports/project-performance", controllers.GetProjectPerformance)
+		auth.GET("/reports/consultants", controllers.GetConsultantReport)
+		auth.GET("/reports/timeseries", controllers.GetTimeseriesReport)
+		auth.GET("/reports/settlements", controllers.GetSettlementReport)
+		auth.GET("/reports/cash-reconciliation", controllers.GetCashReconciliationReport)
+		auth.GET("/reports/below-standard-price", controllers.GetBelowStandardPriceReport)
+		auth.GET("/reports/acquisition", controllers.GetAcquisitionReport)
 	}
 }
@@ -28,7 +28,7 @@ func SeedData() {
 		Role:       models.RoleAdmin,
 		Department: func() *string { s := "管理"; return &s }(),
 		JobNumber:  func() *string { s := "A001"; return &s }(),
-		Phone:      func() *string { s := "13800138000"; return &s }(),
+		Phone:      func() *models.Phone { p := models.Phone("13800138000"); return &p }(),
 		IsActive:   true,
 		CreatedAt:  func() *time.Time { t := time.Now(); return &t }(),
 		UpdatedAt:  func() *time.Time { t := time.Now(); return &t }(),
@@ -37,15 +37,15 @@ func SeedData() {
 
 	// 2. 创建医生
 	doctors := []models.Employee{
-		{Name: "张医生", Role: models.RoleDoctor, Department: func() *string { s := "皮肤科"; return &s }(), JobNumber: func() *string { s := "D001"; return &s }(), Phone: func() *string { s := "13800138001"; return &s }(), IsActive: true, CreatedAt: func() *time.Time { t := time.Now(); return &t }(), UpdatedAt: func() *time.Time { t := time.Now(); return &t }()},
-		{Name: "李医生", Role: models.RoleDoctor, Department: func() *string { s := "美容科"; return &s }(), JobNumber: func() *string { s := "D002"; return &s }(), Phone: func() *string { s := "13800138002"; return &s }(), IsActive: true, CreatedAt: func() *time.Time { t := time.Now(); return &t }(), UpdatedAt: func() *time.Time { t := time.Now(); return &t }()},
+		{Name: "张医生", Role: models.RoleDoctor, Department: func() *string { s := "皮肤科"; return &s }(), JobNumber: func() *string { s := "D001"; return &s }(), Phone: func() *models.Phone { p := models.Phone("13800138001"); return &p }(), IsActive: true, CreatedAt: func() *time.Time { t := time.Now(); return &t }(), UpdatedAt: func() *time.Time { t := time.Now(); return &t }()},
+		{Name: "李医生", Role: models.RoleDoctor, Department: func() *string { s := "美容科"; return &s }(), JobNumber: func() *string { s := "D002"; return &s }(), Phone: func() *models.Phone { p := models.Phone("13800138002"); return &p }(), IsActive: true, CreatedAt: func() *time.Time { t := time.Now(); return &t }(), UpdatedAt: func() *time.Time { t := time.Now(); return &t }()},
 	}
 	db.Create(&doctors)
 
 	// 3. 创建护士
 	nurses := []models.Employee{
-		{Name: "王护士", Role: models.RoleNurse, Department: func() *string { s := "皮肤科"; return &s }(), JobNumber: func() *string { s := "N001"; return &s }(), Phone: func() *string { s := "13800138003"; return &s }(), IsActive: true, CreatedAt: func() *time.Time { t := time.Now(); return &t }(), UpdatedAt: func() *time.Time { t := time.Now(); return &t }()},
-		{Name: "刘护士", Role: models.RoleNurse, Department: func() *string { s := "美容科"; return &s }(), JobNumber: func() *string { s := "N002"; return &s }(), Phone: func() *string { s := "13800138004"; return &s }(), IsActive: true, CreatedAt: func() *time.Time { t := time.Now(); return &t }(), UpdatedAt: func() *time.Time { t := time.Now(); return &t }()},
+		{Name: "王护士", Role: models.RoleNurse, Department: func() *string { s := "皮肤科"; return &s }(), JobNumber: func() *string { s := "N001"; return &s }(), Phone: func() *models.Phone { p := models.Phone("13800138003"); return &p }(), IsActive: true, CreatedAt: func() *time.Time { t := time.Now(); return &t }(), UpdatedAt: func() *time.Time { t := time.Now(); return &t }()},
+		{Name: "刘护士", Role: models.RoleNurse, Department: func() *string { s := "美容科"; return &s }(), JobNumber: func() *string { s := "N002"; return &s }(), Phone: func() *models.Phone { p := models.Phone("13800138004"); return &p }(), IsActive: true, CreatedAt: func() *time.Time { t := time.Now(); return &t }(), UpdatedAt: func() *time.Time { t := time.Now(); return &t }()},
 	}
 	db.Create(&nurses)
 
@@ -55,7 +55,7 @@ func SeedData() {
 		Role:       models.RoleConsultant,
 		Department: func() *string { s := "前台"; return &s }(),
 		JobNumber:  func() *string { s := "C001"; return &s }(),
-		Phone:      func() *string { s := "13800138005"; return &s }(),
+		Phone:      func() *models.Phone { p := models.Phone("13800138005"); return &p }(),
 		IsActive:   true,
 		CreatedAt:  func() *time.Time { t := time.Now(); return &t }(),
 		UpdatedAt:  func() *time.Time { t := time.Now(); return &t }(),
@@ -77,10 +77,10 @@ func SeedData() {
 
 	// 6. 创建项目
 	projects := []models.Project{
-		{Name: "肉毒素注射", Category: func() *string { s := "注射类"; return &s }(), StandardPrice: func() *float64 { p := 2800.0; return &p }(), IsActive: true, CreatedAt: func() *time.Time { t := time.Now(); return &t }(), UpdatedAt: func() *time.Time { t := time.Now(); return &t }()},
-		{Name: "光子嫩肤", Category: func() *string { s := "激光类"; return &s }(), StandardPrice: func() *float64 { p := 1200.0; return &p }(), IsActive: true, CreatedAt: func() *time.Time { t := time.Now(); return &t }(), UpdatedAt: func() *time.Time { t := time.Now(); return &t }()},
-		{Name: "玻尿酸填充", Category: func() *string { s := "注射类"; return &s }(), StandardPrice: func() *float64 { p := 3500.0; return &p }(), IsActive: true, CreatedAt: func() *time.Time { t := time.Now(); return &t }(), UpdatedAt: func() *time.Time { t := time.Now(); return &t }()},
-		{Name: "水光针", Category: func() *string { s := "注射类"; return &s }(), StandardPrice: func() *float64 { p := 800.0; return &p }(), IsActive: true, CreatedAt: func() *time.Time { t := time.Now(); return &t }(), UpdatedAt: func() *time.Time { t := time.Now(); return &t }()},
+		{Name: "肉毒素注射", Category: func() *string { s := "注射类"; return &s }(), StandardPrice: func() *models.Money { p := models.NewMoneyFromFloat(2800.0); return &p }(), IsActive: true, CreatedAt: func() *time.Time { t := time.Now(); return &t }(), UpdatedAt: func() *time.Time { t := time.Now(); return &t }()},
+		{Name: "光子嫩肤", Category: func() *string { s := "激光类"; return &s }(), StandardPrice: func() *models.Money { p := models.NewMoneyFromFloat(1200.0); return &p }(), IsActive: true, CreatedAt: func() *time.Time { t := time.Now(); return &t }(), UpdatedAt: func() *time.Time { t := time.Now(); return &t }()},
+		{Name: "玻尿酸填充", Category: func() *string { s := "注射类"; return &s }(), StandardPrice: func() *models.Money { p := models.NewMoneyFromFloat(3500.0); return &p }(), IsActive: true, CreatedAt: func() *time.Time { t := time.Now(); return &t }(), UpdatedAt: func() *time.Time { t := time.Now(); return &t }()},
+		{Name: "水光针", Category: func() *string { s := "注射类"; return &s }(), StandardPrice: func() *models.Money { p := models.NewMoneyFromFloat(800.0); return &p }(), IsActive: true, CreatedAt: func() *time.Time { t := time.Now(); return &t }(), UpdatedAt: func() *time.Time { t := time.Now(); return &t }()},
 	}
 	db.Create(&projects)
 
@@ -90,6 +90,9 @@ func SeedData() {
 		{Name: "李先生", Phone: "13900139002", CustomerType: func() *string { s := "复诊"; return &s }(), FirstVisitDate: func() *time.Time { t := time.Now().AddDate(0, 0, -60); return &t }(), CreatedAt: func() *time.Time { t := time.Now(); return &t }(), UpdatedAt: func() *time.Time { t := time.Now(); return &t }()},
 		{Name: "张女士", Phone: "13900139003", CustomerType: func() *string { s := "再消费"; return &s }(), FirstVisitDate: func() *time.Time { t := time.Now().AddDate(0, 0, -90); return &t }(), CreatedAt: func() *time.Time { t := time.Now(); return &t }(), UpdatedAt: func() *time.Time { t := time.Now(); return &t }()},
 	}
+	for i := range customers {
+		customers[i].SetPhone(string(customers[i].Phone))
+	}
 	db.Create(&customers)
 
 	log.Println("数据初始化完成！")
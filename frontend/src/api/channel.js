@@ -0,0 +1,32 @@
+import request from '../utils/request'
+
+export const getChannelList = (params) => {
+  return request({
+    url: '/channels',
+    method: 'get',
+    params
+  })
+}
+
+export const createChannel = (data) => {
+  return request({
+    url: '/channels',
+    method: 'post',
+    data
+  })
+}
+
+export const updateChannel = (id, data) => {
+  return request({
+    url: `/channels/${id}`,
+    method: 'put',
+    data
+  })
+}
+
+export const deleteChannel = (id) => {
+  return request({
+    url: `/channels/${id}`,
+    method: 'delete'
+  })
+}
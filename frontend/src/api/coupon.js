@@ -0,0 +1,48 @@
+import request from '../utils/request'
+
+export const getCouponList = (params) => {
+  return request({
+    url: '/coupons',
+    method: 'get',
+    params
+  })
+}
+
+export const getCoupon = (id) => {
+  return request({
+    url: `/coupons/${id}`,
+    method: 'get'
+  })
+}
+
+export const createCoupon = (data) => {
+  return request({
+    url: '/coupons',
+    method: 'post',
+    data
+  })
+}
+
+export const updateCoupon = (id, data) => {
+  return request({
+    url: `/coupons/${id}`,
+    method: 'put',
+    data
+  })
+}
+
+export const deleteCoupon = (id) => {
+  return request({
+    url: `/coupons/${id}`,
+    method: 'delete'
+  })
+}
+
+export const getCustomerCouponList = (params) => {
+  return request({
+    url: '/customer-coupons',
+    method: 'get',
+    params
+  })
+}
+
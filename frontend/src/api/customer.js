@@ -15,6 +15,13 @@ export const getCustomer = (id) => {
   })
 }
 
+export const getCustomerTimeline = (id) => {
+  return request({
+    url: `/customers/${id}/timeline`,
+    method: 'get'
+  })
+}
+
 export const createCustomer = (data) => {
   return request({
     url: '/customers',
@@ -37,3 +44,120 @@ export const deleteCustomer = (id) => {
     method: 'delete'
   })
 }
+
+export const getStoredValueAccount = (id) => {
+  return request({
+    url: `/customers/${id}/stored-value`,
+    method: 'get'
+  })
+}
+
+export const getStoredValueTransactions = (id, params) => {
+  return request({
+    url: `/customers/${id}/stored-value/transactions`,
+    method: 'get',
+    params
+  })
+}
+
+export const topUpStoredValue = (id, data) => {
+  return request({
+    url: `/customers/${id}/stored-value/top-up`,
+    method: 'post',
+    data
+  })
+}
+
+export const refundStoredValue = (id, data) => {
+  return request({
+    url: `/customers/${id}/stored-value/refund`,
+    method: 'post',
+    data
+  })
+}
+
+export const getDuplicateCustomers = (params) => {
+  return request({
+    url: '/customers/duplicates',
+    method: 'get',
+    params
+  })
+}
+
+export const mergeCustomers = (id, data) => {
+  return request({
+    url: `/customers/${id}/merge`,
+    method: 'post',
+    data
+  })
+}
+
+export const getCustomerMergeLogs = (params) => {
+  return request({
+    url: '/customer-merge-logs',
+    method: 'get',
+    params
+  })
+}
+
+export const revealCustomerPhone = (id) => {
+  return request({
+    url: `/customers/${id}/phone`,
+    method: 'get'
+  })
+}
+
+export const getContactAccessLogs = (params) => {
+  return request({
+    url: '/contact-access-logs',
+    method: 'get',
+    params
+  })
+}
+
+export const getCustomerRFM = (params) => {
+  return request({
+    url: '/customers/rfm',
+    method: 'get',
+    params
+  })
+}
+
+export const exportCustomerRFM = (params) => {
+  return request({
+    url: '/customers/rfm',
+    method: 'get',
+    params: { ...params, format: 'csv' },
+    responseType: 'blob'
+  })
+}
+
+export const getRFMSegments = () => {
+  return request({
+    url: '/rfm-segments',
+    method: 'get'
+  })
+}
+
+export const createRFMSegment = (data) => {
+  return request({
+    url: '/rfm-segments',
+    method: 'post',
+    data
+  })
+}
+
+export const updateRFMSegment = (id, data) => {
+  return request({
+    url: `/rfm-segments/${id}`,
+    method: 'put',
+    data
+  })
+}
+
+export const deleteRFMSegment = (id) => {
+  return request({
+    url: `/rfm-segments/${id}`,
+    method: 'delete'
+  })
+}
@@ -0,0 +1,54 @@
+import request from '../utils/request'
+
+export const getPackageList = (params) => {
+  return request({
+    url: '/packages',
+    method: 'get',
+    params
+  })
+}
+
+export const getPackage = (id) => {
+  return request({
+    url: `/packages/${id}`,
+    method: 'get'
+  })
+}
+
+export const createPackage = (data) => {
+  return request({
+    url: '/packages',
+    method: 'post',
+    data
+  })
+}
+
+export const updatePackage = (id, data) => {
+  return request({
+    url: `/packages/${id}`,
+    method: 'put',
+    data
+  })
+}
+
+export const deletePackage = (id) => {
+  return request({
+    url: `/packages/${id}`,
+    method: 'delete'
+  })
+}
+
+export const getCustomerPackageList = (params) => {
+  return request({
+    url: '/customer-packages',
+    method: 'get',
+    params
+  })
+}
+
+export const getCustomerPackage = (id) => {
+  return request({
+    url: `/customer-packages/${id}`,
+    method: 'get'
+  })
+}
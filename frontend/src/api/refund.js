@@ -0,0 +1,31 @@
+import request from '../utils/request'
+
+export const getRefundList = (params) => {
+  return request({
+    url: '/refunds',
+    method: 'get',
+    params
+  })
+}
+
+export const getRefund = (id) => {
+  return request({
+    url: `/refunds/${id}`,
+    method: 'get'
+  })
+}
+
+export const createRefund = (data) => {
+  return request({
+    url: '/refunds',
+    method: 'post',
+    data
+  })
+}
+
+export const deleteRefund = (id) => {
+  return request({
+    url: `/refunds/${id}`,
+    method: 'delete'
+  })
+}
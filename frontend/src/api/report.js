@@ -23,3 +23,43 @@ export const getProjectPerformance = (params) => {
     params
   })
 }
+
+export const getCashReconciliationReport = (params) => {
+  return request({
+    url: '/reports/cash-reconciliation',
+    method: 'get',
+    params
+  })
+}
+
+export const getBelowStandardPriceReport = (params) => {
+  return request({
+    url: '/reports/below-standard-price',
+    method: 'get',
+    params
+  })
+}
+
+export const getAcquisitionReport = (params) => {
+  return request({
+    url: '/reports/acquisition',
+    method: 'get',
+    params
+  })
+}
+
+export const getConsultantReport = (params) => {
+  return request({
+    url: '/reports/consultants',
+    method: 'get',
+    params
+  })
+}
+
+export const getTimeseriesReport = (params) => {
+  return request({
+    url: '/reports/timeseries',
+    method: 'get',
+    params
+  })
+}
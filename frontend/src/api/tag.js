@@ -0,0 +1,76 @@
+import request from '../utils/request'
+
+export const getTagList = () => {
+  return request({
+    url: '/tags',
+    method: 'get'
+  })
+}
+
+export const createTag = (data) => {
+  return request({
+    url: '/tags',
+    method: 'post',
+    data
+  })
+}
+
+export const updateTag = (id, data) => {
+  return request({
+    url: `/tags/${id}`,
+    method: 'put',
+    data
+  })
+}
+
+export const deleteTag = (id) => {
+  return request({
+    url: `/tags/${id}`,
+    method: 'delete'
+  })
+}
+
+export const setCustomerTags = (customerId, tags) => {
+  return request({
+    url: `/customers/${customerId}/tags`,
+    method: 'put',
+    data: { tags }
+  })
+}
+
+export const getCustomerSegmentList = () => {
+  return request({
+    url: '/customer-segments',
+    method: 'get'
+  })
+}
+
+export const getCustomerSegment = (id) => {
+  return request({
+    url: `/customer-segments/${id}`,
+    method: 'get'
+  })
+}
+
+export const createCustomerSegment = (data) => {
+  return request({
+    url: '/customer-segments',
+    method: 'post',
+    data
+  })
+}
+
+export const updateCustomerSegment = (id, data) => {
+  return request({
+    url: `/customer-segments/${id}`,
+    method: 'put',
+    data
+  })
+}
+
+export const deleteCustomerSegment = (id) => {
+  return request({
+    url: `/customer-segments/${id}`,
+    method: 'delete'
+  })
+}
@@ -37,3 +37,47 @@ export const deleteVisit = (id) => {
     method: 'delete'
   })
 }
+
+export const confirmVisit = (id) => {
+  return request({
+    url: `/visits/${id}/confirm`,
+    method: 'post'
+  })
+}
+
+export const voidVisit = (id, data) => {
+  return request({
+    url: `/visits/${id}/void`,
+    method: 'post',
+    data
+  })
+}
+
+export const reopenVisit = (id) => {
+  return request({
+    url: `/visits/${id}/reopen`,
+    method: 'post'
+  })
+}
+
+export const getVisitPayments = (id) => {
+  return request({
+    url: `/visits/${id}/payments`,
+    method: 'get'
+  })
+}
+
+export const createVisitPayment = (id, data) => {
+  return request({
+    url: `/visits/${id}/payments`,
+    method: 'post',
+    data
+  })
+}
+
+export const deleteVisitPayment = (id, paymentId) => {
+  return request({
+    url: `/visits/${id}/payments/${paymentId}`,
+    method: 'delete'
+  })
+}
@@ -24,6 +24,11 @@ request.interceptors.request.use(
 // 响应拦截器
 request.interceptors.response.use(
   response => {
+    // 文件下载（如 CSV 导出）直接返回文件内容
+    if (response.config.responseType === 'blob') {
+      return response.data
+    }
+
     const { code, message, data } = response.data
     
     if (code === 200) {
@@ -37,6 +42,8 @@ request.interceptors.response.use(
     const { response } = error
     
     if (response) {
+      // 字段级校验错误，表单可根据 field 定位到具体表单项
+      error.fieldErrors = response.data?.errors || []
       switch (response.status) {
         case 401:
           ElMessage.error('登录已过期，请重新登录')